@@ -12,11 +12,14 @@ import (
 	"os"
 	"os/signal"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"scope"
 )
 
 // --- Global State ---
@@ -24,7 +27,9 @@ var (
 	vulnIPs, vulnPorts, totalDone int64
 	startTime                     time.Time
 	ipMap                         sync.Map
-	printMu                       sync.Mutex // Prevents worker output overlap
+	printMu                       sync.Mutex   // Prevents worker output overlap
+	scopeLogMu                    sync.Mutex   // Serializes writes to inspector_scope.log
+	inScope                       *scope.Rules // Engagement scope (nil = unrestricted)
 	userAgents                    = []string{
 		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
 		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
@@ -52,9 +57,50 @@ func logFinding(ip, port, details string) {
 	f.WriteString(fmt.Sprintf("[%-19s] %-15s:%-5s | %-20s\n", time.Now().Format("2006-01-02 15:04"), ip, port, details))
 }
 
+// logRefusal records a scope refusal in inspector_scope.log, apart from the findings
+func logRefusal(msg string) {
+	scopeLogMu.Lock()
+	defer scopeLogMu.Unlock()
+	f, err := os.OpenFile("inspector_scope.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[!] Can't write scope log: %v\n", err)
+		return
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "[%-19s] %s\n", time.Now().Format("2006-01-02 15:04"), msg)
+}
+
+// targetAllowed checks a target against the scope. Knock passes hostname
+// targets through, so those are checked by name and by every address they
+// resolve to, since the inspection may connect to any of them.
+func targetAllowed(target string) bool {
+	if inScope == nil {
+		return true
+	}
+	if net.ParseIP(target) != nil {
+		return inScope.AllowIP(target, "inspect")
+	}
+	if !inScope.AllowHost(target, "inspect") {
+		return false
+	}
+	addrs, err := net.LookupHost(target)
+	if err != nil || len(addrs) == 0 {
+		inScope.Refuse("inspect", target, "does not resolve")
+		return false
+	}
+	allowed := true
+	for _, addr := range addrs {
+		if !inScope.AllowIP(addr, "inspect "+target) {
+			allowed = false
+		}
+	}
+	return allowed
+}
+
 func main() {
 	fileInput := flag.String("f", "", "File of knocker results")
 	target := flag.String("t", "", "Direct input (IP:PORT)")
+	scopeFile := flag.String("scope", "", "Engagement scope file; out-of-scope targets and Host headers are refused and logged to inspector_scope.log")
 	showHelp := flag.Bool("h", false, "Show help screen")
 	flag.Parse()
 
@@ -71,6 +117,20 @@ func main() {
 		os.Exit(0)
 	}()
 
+	if *scopeFile != "" {
+		rules, err := scope.Load(*scopeFile, func(msg string) {
+			logRefusal(msg)
+			printMu.Lock()
+			fmt.Printf("\r\033[K\033[33m  [-] %s\033[0m\n", msg)
+			printMu.Unlock()
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		inScope = rules
+	}
+
 	startTime = time.Now()
 	rand.Seed(time.Now().UnixNano())
 	stdoutIsTTY := isTerminal(os.Stdout)
@@ -138,6 +198,10 @@ func main() {
 			}
 
 			if strings.EqualFold(status, "Open") || strings.EqualFold(status, "Open/Filtered") {
+				portNum, _ := strconv.Atoi(port)
+				if !targetAllowed(ip) || !inScope.AllowPort(portNum, "inspect "+ip) {
+					return
+				}
 				if port == "80" || port == "443" || port == "8080" || port == "8443" {
 					inspectHTTP(ip, port, host)
 				} else {
@@ -169,6 +233,9 @@ func inspectHTTP(ip, port, host string) {
 	}
 
 	for _, h := range hosts {
+		if h != ip && !inScope.AllowHost(h, "Host header") {
+			continue
+		}
 		proto := "http"
 		if port == "443" || port == "8443" {
 			proto = "https"
@@ -7,7 +7,7 @@ GOBIN="/Users/anthony/go/bin"
 mkdir -p $GOBIN
 
 # Build the application
-go build -o $GOBIN/knock ./cmd/main.go
+go build -o $GOBIN/knock ./cmd
 
 # Make the binary executable
 chmod +x $GOBIN/knock
@@ -12,6 +12,8 @@ import (
 	"sync"
 	"text/tabwriter"
 	"time"
+
+	"scope"
 )
 
 type PortResult struct {
@@ -56,6 +58,7 @@ func main() {
 	desc := flag.Bool("desc", false, "Description mode (detailed table)")
 	delay := flag.Int("delay", 0, "Delay between ports (ms)")
 	domain := flag.String("d", "", "Target domain for host header injection")
+	scopeFile := flag.String("scope", "", "Engagement scope file; out-of-scope targets and ports are refused and logged")
 	showHelp := flag.Bool("h", false, "Show help screen")
 	flag.Parse()
 
@@ -89,6 +92,19 @@ func main() {
 		}
 	}
 
+	var inScope *scope.Rules
+	if *scopeFile != "" {
+		rules, err := scope.Load(*scopeFile, func(msg string) {
+			logKnock(msg)
+			fmt.Fprintf(os.Stderr, "\033[33m[-] %s\033[0m\n", msg)
+		})
+		if err != nil {
+			fmt.Printf("Error loading scope: %v\n", err)
+			os.Exit(1)
+		}
+		inScope = rules
+	}
+
 	tcpPorts := []int{7, 9, 13, 21, 22, 23, 25, 26, 37, 53, 79, 80, 81, 88, 106, 110, 111, 113, 119, 135, 139, 143, 144, 179, 199, 389, 427, 443, 444, 445, 465, 513, 514, 515, 543, 544, 548, 554, 587, 631, 646, 873, 990, 993, 995, 1025, 1026, 1027, 1028, 1029, 1110, 1433, 1720, 1723, 1755, 1900, 2000, 2049, 2121, 2717, 3000, 3128, 3306, 3389, 3986, 4899, 5000, 5009, 5051, 5060, 5101, 5190, 5357, 5432, 5631, 5666, 5800, 5900, 6000, 6001, 6646, 7070, 8000, 8008, 8009, 8080, 8081, 8443, 8888, 9100, 9999, 10000, 32768, 49152, 49153, 49154, 49155, 49156, 49157}
 	udpPorts := []int{7, 9, 17, 19, 53, 67, 68, 69, 111, 123, 135, 137, 138, 139, 161, 162, 177, 443, 445, 500, 514, 515, 518, 520, 593, 623, 626, 631, 996, 997, 998, 999, 1022, 1023, 1025, 1026, 1027, 1028, 1029, 1030, 1433, 1434, 1645, 1646, 1701, 1718, 1719, 1812, 1813, 1900, 2000, 2048, 2049, 2222, 3130, 3283, 3456, 3703, 4444, 4500, 5000, 5060, 5353, 5355, 5632, 9200, 10000, 17185, 20031, 27015, 27374, 30718, 31337, 32768, 32769, 32771, 32815, 33281, 49152, 49153, 49154, 49156, 49181, 49182, 49185, 49186, 49188, 49189, 49190, 49191, 49192, 49193, 49194, 49200, 49201, 49202}
 
@@ -96,6 +112,25 @@ func main() {
 	if *udpMode {
 		targetPorts = udpPorts
 	}
+	targetPorts = inScope.FilterPorts(targetPorts, "ports")
+
+	// Refuse every target outside the engagement before anything is sent
+	var kept []string
+	for _, t := range targets {
+		if t == "" {
+			continue
+		}
+		var allowed bool
+		if net.ParseIP(t) != nil {
+			allowed = inScope.AllowIP(t, "scan")
+		} else {
+			allowed = inScope.AllowHost(t, "scan") && hostAddrsAllowed(inScope, t)
+		}
+		if allowed {
+			kept = append(kept, t)
+		}
+	}
+	targets = kept
 
 	ipSem := make(chan struct{}, 5)
 	var mainWg sync.WaitGroup
@@ -111,6 +146,26 @@ func main() {
 	mainWg.Wait()
 }
 
+// hostAddrsAllowed resolves a hostname target and checks every address it
+// points at, since the scan may connect to any of them
+func hostAddrsAllowed(rules *scope.Rules, host string) bool {
+	if rules == nil {
+		return true
+	}
+	addrs, err := net.LookupHost(host)
+	if err != nil || len(addrs) == 0 {
+		rules.Refuse("scan", host, "does not resolve")
+		return false
+	}
+	allowed := true
+	for _, addr := range addrs {
+		if !rules.AllowIP(addr, "scan "+host) {
+			allowed = false
+		}
+	}
+	return allowed
+}
+
 func processIP(ip string, ports []int, silent, verbose, desc, udpMode bool, delay int, domainUsed string) {
 	shuffled := make([]int, len(ports))
 	copy(shuffled, ports)
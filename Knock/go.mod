@@ -1,3 +1,7 @@
 module knockknock
 
 go 1.25.5
+
+require scope v0.0.0
+
+replace scope => ../Scope
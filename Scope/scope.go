@@ -0,0 +1,258 @@
+// Package scope loads the engagement scope file shared by Scratch, Knock and
+// Inspect and answers whether a host, address or port may be touched.
+package scope
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The scope file has one rule per line; # starts a comment:
+//
+//	include example.com        exact host
+//	include *.example.com      any name below example.com
+//	exclude vpn.example.com    excludes always win over includes
+//	include 203.0.113.0/24     networks or single addresses
+//	exclude 203.0.113.7
+//	ports 80,443,8000-8100     ports that may be contacted
+//
+// A category without include rules (no domains, no networks or no ports) is
+// not restricted by the file, apart from its excludes.
+
+// Rules is a loaded scope file. A nil *Rules allows everything.
+type Rules struct {
+	includeHosts, excludeHosts []string
+	includeNets, excludeNets   []*net.IPNet
+	ports                      map[int]bool
+	logf                       func(msg string) // records every refusal
+}
+
+// Load parses a scope file; refusals are passed to logf
+func Load(path string, logf func(msg string)) (*Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &Rules{ports: make(map[int]bool), logf: logf}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<include|exclude|ports> <value>\"", path, n)
+		}
+		keyword, value := strings.ToLower(fields[0]), strings.ToLower(fields[1])
+		switch keyword {
+		case "include", "exclude":
+			network := parseScopeNet(value)
+			if network == nil && !validScopeHost(value) {
+				return nil, fmt.Errorf("%s:%d: invalid domain or network %q", path, n, value)
+			}
+			switch {
+			case keyword == "include" && network != nil:
+				s.includeNets = append(s.includeNets, network)
+			case keyword == "exclude" && network != nil:
+				s.excludeNets = append(s.excludeNets, network)
+			case keyword == "include":
+				s.includeHosts = append(s.includeHosts, value)
+			default:
+				s.excludeHosts = append(s.excludeHosts, value)
+			}
+		case "ports":
+			for _, part := range strings.Split(value, ",") {
+				lo, hi, isRange := strings.Cut(part, "-")
+				if !isRange {
+					hi = lo
+				}
+				from, err1 := strconv.Atoi(lo)
+				to, err2 := strconv.Atoi(hi)
+				if err1 != nil || err2 != nil || from < 1 || to > 65535 || from > to {
+					return nil, fmt.Errorf("%s:%d: invalid port or range %q", path, n, part)
+				}
+				for p := from; p <= to; p++ {
+					s.ports[p] = true
+				}
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown keyword %q", path, n, fields[0])
+		}
+	}
+	return s, scanner.Err()
+}
+
+// parseScopeNet reads a CIDR or a single address as a network
+func parseScopeNet(value string) *net.IPNet {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		return network
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// validScopeHost accepts a host name, optionally behind a leading "*."
+func validScopeHost(value string) bool {
+	labels := strings.Split(strings.TrimPrefix(value, "*."), ".")
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || strings.ContainsFunc(label, func(c rune) bool {
+			return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_')
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchScopeHost reports whether name matches an exact or "*." pattern
+func matchScopeHost(pattern, name string) bool {
+	if parent, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(name, "."+parent)
+	}
+	return name == pattern
+}
+
+// hostAllowed returns why name is out of scope, or "" when it is in scope
+func (s *Rules) hostAllowed(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	for _, pattern := range s.excludeHosts {
+		if matchScopeHost(pattern, name) {
+			return "excluded by " + pattern
+		}
+	}
+	if len(s.includeHosts) == 0 {
+		return ""
+	}
+	for _, pattern := range s.includeHosts {
+		if matchScopeHost(pattern, name) {
+			return ""
+		}
+	}
+	return "not under any included domain"
+}
+
+// ipAllowed returns why value (an address or a CIDR) is out of scope, or ""
+// when it is in scope. A CIDR is only in scope when the whole range is: it has
+// to fit inside one include and may not overlap any exclude.
+func (s *Rules) ipAllowed(value string) string {
+	var first, last net.IP
+	if ip := net.ParseIP(value); ip != nil {
+		first, last = ip, ip
+	} else if _, network, err := net.ParseCIDR(value); err == nil {
+		first, last = network.IP, lastAddr(network)
+	} else {
+		return "not an IP address"
+	}
+	for _, network := range s.excludeNets {
+		if network.Contains(first) || network.Contains(last) || inRange(network.IP, first, last) {
+			return "excluded by " + network.String()
+		}
+	}
+	if len(s.includeNets) == 0 {
+		return ""
+	}
+	for _, network := range s.includeNets {
+		if network.Contains(first) && network.Contains(last) {
+			return ""
+		}
+	}
+	if !first.Equal(last) {
+		return "range not inside any included network"
+	}
+	return "not in any included network"
+}
+
+// lastAddr returns the highest address of network
+func lastAddr(network *net.IPNet) net.IP {
+	last := make(net.IP, len(network.IP))
+	for i := range network.IP {
+		last[i] = network.IP[i] | ^network.Mask[i]
+	}
+	return last
+}
+
+// inRange reports whether ip lies between first and last, inclusive
+func inRange(ip, first, last net.IP) bool {
+	if v4 := ip.To4(); v4 != nil && first.To4() != nil {
+		ip, first, last = v4, first.To4(), last.To4()
+	}
+	if len(ip) != len(first) {
+		return false
+	}
+	return bytes.Compare(ip, first) >= 0 && bytes.Compare(ip, last) <= 0
+}
+
+// AllowHost checks a host name and logs the refusal when it is out of scope.
+// what says which discovery or action was refused (e.g. "CT", "Host header").
+func (s *Rules) AllowHost(name, what string) bool {
+	if s == nil {
+		return true
+	}
+	if reason := s.hostAllowed(name); reason != "" {
+		s.Refuse(what, name, reason)
+		return false
+	}
+	return true
+}
+
+// AllowIP checks an address or CIDR and logs the refusal when it is out of scope
+func (s *Rules) AllowIP(ip, what string) bool {
+	if s == nil {
+		return true
+	}
+	if reason := s.ipAllowed(ip); reason != "" {
+		s.Refuse(what, ip, reason)
+		return false
+	}
+	return true
+}
+
+// AllowPort checks a port against the ports rule and logs the refusal
+func (s *Rules) AllowPort(port int, what string) bool {
+	if s == nil || len(s.ports) == 0 || s.ports[port] {
+		return true
+	}
+	s.Refuse(what, strconv.Itoa(port), "port not allowed")
+	return false
+}
+
+// FilterPorts drops the ports the ports rule doesn't allow, logging them as one refusal
+func (s *Rules) FilterPorts(ports []int, what string) []int {
+	if s == nil || len(s.ports) == 0 {
+		return ports
+	}
+	var kept []int
+	var refused []string
+	for _, p := range ports {
+		if s.ports[p] {
+			kept = append(kept, p)
+		} else {
+			refused = append(refused, strconv.Itoa(p))
+		}
+	}
+	if len(refused) > 0 {
+		s.Refuse(what, strings.Join(refused, ","), "port not allowed")
+	}
+	return kept
+}
+
+// Refuse logs that target was refused for reason
+func (s *Rules) Refuse(what, target, reason string) {
+	if s != nil && s.logf != nil {
+		s.logf(fmt.Sprintf("SCOPE REFUSED %s %s: %s", what, target, reason))
+	}
+}
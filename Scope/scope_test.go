@@ -0,0 +1,145 @@
+package scope
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadLocal loads the test zone's scope file, collecting refusals
+func loadLocal(t *testing.T) (*Rules, *[]string) {
+	t.Helper()
+	var refused []string
+	rules, err := Load("../testenv/scope-local.txt", func(msg string) { refused = append(refused, msg) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules, &refused
+}
+
+func TestAllowHost(t *testing.T) {
+	rules, _ := loadLocal(t)
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"local.test", true},
+		{"www.local.test", true},
+		{"WWW.Local.Test.", true},
+		{"a.b.local.test", true},
+		{"static.local.test", false}, // exclude wins over *.local.test
+		{"notlocal.test", false},     // *. only matches below the parent
+		{"local.test.evil.example", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if got := rules.AllowHost(tt.host, "test"); got != tt.want {
+			t.Errorf("AllowHost(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAllowIP(t *testing.T) {
+	rules, _ := loadLocal(t)
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"127.255.255.255", true},
+		{"10.0.0.1", false},
+		{"127.0.0.0/16", true},
+		{"126.0.0.0/7", false}, // starts outside 127.0.0.0/8
+		{"127.0.0.0/7", false}, // network address inside, range wider than the include
+		{"www.local.test", false},
+	}
+	for _, tt := range tests {
+		if got := rules.AllowIP(tt.ip, "test"); got != tt.want {
+			t.Errorf("AllowIP(%q) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestExcludeWinsOverInclude(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scope.txt")
+	rules := "include *.example.com\nexclude *.vpn.example.com\ninclude 10.0.0.0/8\nexclude 10.1.2.3\n"
+	if err := os.WriteFile(path, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"included host", s.AllowHost("www.example.com", "test"), true},
+		{"excluded wildcard", s.AllowHost("gw.vpn.example.com", "test"), false},
+		{"included address", s.AllowIP("10.9.9.9", "test"), true},
+		{"excluded address", s.AllowIP("10.1.2.3", "test"), false},
+		{"range overlapping an exclude", s.AllowIP("10.1.2.0/24", "test"), false},
+		{"ports unrestricted", s.AllowPort(22, "test"), true},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestAllowPort(t *testing.T) {
+	rules, refused := loadLocal(t)
+	tests := []struct {
+		port int
+		want bool
+	}{
+		{80, true},
+		{2525, true},
+		{22, false},
+	}
+	for _, tt := range tests {
+		if got := rules.AllowPort(tt.port, "test"); got != tt.want {
+			t.Errorf("AllowPort(%d) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+	if len(*refused) != 1 || !strings.Contains((*refused)[0], "SCOPE REFUSED test 22") {
+		t.Errorf("refusals = %q, want one for port 22", *refused)
+	}
+
+	kept := rules.FilterPorts([]int{22, 443, 8080, 9999}, "test")
+	if len(kept) != 2 || kept[0] != 443 || kept[1] != 8080 {
+		t.Errorf("FilterPorts kept %v, want [443 8080]", kept)
+	}
+}
+
+func TestNilRulesAllowEverything(t *testing.T) {
+	var rules *Rules
+	if !rules.AllowHost("anything.example", "test") || !rules.AllowIP("8.8.8.8", "test") || !rules.AllowPort(1, "test") {
+		t.Error("nil rules refused a target")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"include", "expected"},
+		{"include bad_host!", "invalid domain or network"},
+		{"ports 0-10", "invalid port"},
+		{"ports 90-80", "invalid port"},
+		{"allow example.com", "unknown keyword"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "scope.txt")
+		if err := os.WriteFile(path, []byte(tt.rule+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path, nil); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Load(%q) error = %v, want %q", tt.rule, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"sort"
+	"sync"
+)
+
+// evidence is one observation made during a scan: host resolved to an address
+// (A/AAAA) or aliased another name (CNAME), as reported by source
+type evidence struct {
+	Host   string `json:"host"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// hostAsset is a name with everything seen about it
+type hostAsset struct {
+	Name     string
+	IPs      map[string]bool
+	Aliases  []string   // CNAME targets, in the order they were seen
+	Chain    []cnameHop // full chain traced hop by hop, once Traced
+	Traced   bool
+	CNAME    *cnameEntry // last answer for an aliased host, revisited by the takeover check
+	Sources  map[string]bool
+	Evidence []*evidence
+}
+
+// ipAsset is an address, the hosts that resolved to it and the sources that said so
+type ipAsset struct {
+	Addr    string
+	Hosts   map[string]bool
+	Sources map[string]bool
+}
+
+// subnetAsset is the /24 (IPv4) or /v6Bits (IPv6) network a set of addresses belongs to
+type subnetAsset struct {
+	CIDR string
+	IPs  map[string]bool
+}
+
+// assetStore links the hosts, addresses, aliases, subnets and sources of one
+// domain's scan. It is safe for concurrent use by the workers.
+type assetStore struct {
+	mu       sync.RWMutex
+	v6Bits   int
+	hosts    map[string]*hostAsset
+	ips      map[string]*ipAsset
+	subnets  map[string]*subnetAsset
+	evidence []*evidence
+	seen     map[evidence]bool
+}
+
+var assets = newAssetStore(64)
+
+// newAssetStore returns an empty store grouping IPv6 addresses by /v6Bits
+func newAssetStore(v6Bits int) *assetStore {
+	return &assetStore{
+		v6Bits:  v6Bits,
+		hosts:   make(map[string]*hostAsset),
+		ips:     make(map[string]*ipAsset),
+		subnets: make(map[string]*subnetAsset),
+		seen:    make(map[evidence]bool),
+	}
+}
+
+// addAddress records that host resolved to ip according to source. ip may also
+// be an SPF-style CIDR.
+func (s *assetStore) addAddress(host, ip, source string) {
+	kind := "A"
+	if addr := parseAddr(ip); addr != nil && addr.To4() == nil {
+		kind = "AAAA"
+	}
+	s.add(evidence{Host: host, Kind: kind, Value: ip, Source: source})
+}
+
+// addAliases records host's CNAME chain hop by hop
+func (s *assetStore) addAliases(host string, chain []string, source string) {
+	for _, target := range chain {
+		s.add(evidence{Host: host, Kind: "CNAME", Value: target, Source: source})
+		host = target
+	}
+}
+
+// add links one piece of evidence into the store; repeats are ignored
+func (s *assetStore) add(ev evidence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[ev] {
+		return
+	}
+	s.seen[ev] = true
+	e := &ev
+	s.evidence = append(s.evidence, e)
+
+	h := s.host(ev.Host)
+	h.Sources[ev.Source] = true
+	h.Evidence = append(h.Evidence, e)
+
+	if ev.Kind == "CNAME" {
+		h.Aliases = append(h.Aliases, ev.Value)
+		return
+	}
+	h.IPs[ev.Value] = true
+	ip := s.ips[ev.Value]
+	if ip == nil {
+		ip = &ipAsset{Addr: ev.Value, Hosts: make(map[string]bool), Sources: make(map[string]bool)}
+		s.ips[ev.Value] = ip
+		if cidr, ok := subnetOf(ev.Value, s.v6Bits); ok {
+			if s.subnets[cidr] == nil {
+				s.subnets[cidr] = &subnetAsset{CIDR: cidr, IPs: make(map[string]bool)}
+			}
+			s.subnets[cidr].IPs[ev.Value] = true
+		}
+	}
+	ip.Hosts[ev.Host] = true
+	ip.Sources[ev.Source] = true
+}
+
+// host returns the entry for name, creating it. The caller holds the write lock.
+func (s *assetStore) host(name string) *hostAsset {
+	h := s.hosts[name]
+	if h == nil {
+		h = &hostAsset{Name: name, IPs: make(map[string]bool), Sources: make(map[string]bool)}
+		s.hosts[name] = h
+	}
+	return h
+}
+
+// setChain stores the chain traced for host
+func (s *assetStore) setChain(host string, hops []cnameHop) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.host(host)
+	h.Chain, h.Traced = hops, true
+}
+
+// tracedChain returns the chain traced for host and whether it was traced at all
+func (s *assetStore) tracedChain(host string) ([]cnameHop, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if h := s.hosts[host]; h != nil && h.Traced {
+		return h.Chain, true
+	}
+	return nil, false
+}
+
+// chainOf returns host's traced chain or, when it wasn't traced, the one its
+// alias links record. Nil when host isn't an alias.
+func (s *assetStore) chainOf(host string) []cnameHop {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := s.hosts[host]
+	if h == nil {
+		return nil
+	}
+	if h.Traced {
+		return h.Chain
+	}
+	var hops []cnameHop
+	seen := map[string]bool{host: true}
+	for len(h.Aliases) > 0 && len(hops) < maxChainHops {
+		next := h.Aliases[0]
+		if seen[next] {
+			break
+		}
+		seen[next] = true
+		hops = append(hops, classifyHop(next))
+		if h = s.hosts[next]; h == nil {
+			break
+		}
+	}
+	return hops
+}
+
+// trackAlias keeps entry as host's CNAME answer unless a conclusive one is
+// already stored; answers that left the target's liveness unknown are replaced
+func (s *assetStore) trackAlias(host string, entry *cnameEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.host(host)
+	if h.CNAME == nil || h.CNAME.Unknown {
+		h.CNAME = entry
+	}
+}
+
+// aliasOf returns the CNAME answer tracked for host, or nil
+func (s *assetStore) aliasOf(host string) *cnameEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if h := s.hosts[host]; h != nil {
+		return h.CNAME
+	}
+	return nil
+}
+
+// aliasedHosts returns every host with a tracked CNAME answer, sorted
+func (s *assetStore) aliasedHosts() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	for name, h := range s.hosts {
+		if h.CNAME != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hostView is a copy of what the store knows about a host, for the output writers
+type hostView struct {
+	Name    string
+	IPs     []string // addresses source reported for the host, in the order seen
+	Chain   []cnameHop
+	Sources []string // every source that reported the host
+}
+
+// view returns host as reported by source
+func (s *assetStore) view(host, source string) hostView {
+	chain := s.chainOf(host)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v := hostView{Name: host, Chain: chain}
+	h := s.hosts[host]
+	if h == nil {
+		return v
+	}
+	for _, e := range h.Evidence {
+		if e.Source == source && e.Kind != "CNAME" {
+			v.IPs = append(v.IPs, e.Value)
+		}
+	}
+	v.Sources = sortedKeys(h.Sources)
+	return v
+}
+
+// hostNames returns every host that resolved to an address, sorted
+func (s *assetStore) hostNames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var names []string
+	for name, h := range s.hosts {
+		if len(h.IPs) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// hasHost reports whether host resolved to an address
+func (s *assetStore) hasHost(host string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h := s.hosts[host]
+	return h != nil && len(h.IPs) > 0
+}
+
+// hostsOf returns the hosts that resolved to ip, sorted
+func (s *assetStore) hostsOf(ip string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a := s.ips[ip]
+	if a == nil {
+		return nil
+	}
+	return sortedKeys(a.Hosts)
+}
+
+// hostCount returns how many distinct hosts resolved to ip
+func (s *assetStore) hostCount(ip string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a := s.ips[ip]; a != nil {
+		return len(a.Hosts)
+	}
+	return 0
+}
+
+// sourcesOf returns the sources that reported ip, sorted
+func (s *assetStore) sourcesOf(ip string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a := s.ips[ip]; a != nil {
+		return sortedKeys(a.Sources)
+	}
+	return nil
+}
+
+// subnetGroups returns every subnet with its addresses, counting the distinct
+// hosts behind each address
+func (s *assetStore) subnetGroups() map[string]*SubnetGroup {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	groups := make(map[string]*SubnetGroup)
+	for cidr, subnet := range s.subnets {
+		group := &SubnetGroup{IPs: make(map[string]bool)}
+		for addr := range subnet.IPs {
+			group.IPs[addr] = true
+			group.Hosts += len(s.ips[addr].Hosts)
+		}
+		groups[cidr] = group
+	}
+	return groups
+}
+
+// snapshot returns a copy of every piece of evidence in the order it was recorded
+func (s *assetStore) snapshot() []evidence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]evidence, len(s.evidence))
+	for i, e := range s.evidence {
+		out[i] = *e
+	}
+	return out
+}
+
+// load replays evidence saved by snapshot
+func (s *assetStore) load(saved []evidence) {
+	for _, ev := range saved {
+		s.add(ev)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// nameserver is one authoritative server for the target zone
+type nameserver struct {
+	Name string
+	IPs  []string
+}
+
+// lookupNameservers resolves the zone's NS set and each server's addresses
+func lookupNameservers(domain string) []nameserver {
+	res, err := queryDNS(domain, dns.TypeNS, getRandomResolver())
+	if err != nil || !res.Exists() {
+		return nil
+	}
+
+	var servers []nameserver
+	for _, rec := range res.Answers {
+		if rec.Type != "NS" {
+			continue
+		}
+		ns := nameserver{Name: rec.Value}
+		if addrs, err := lookupHost(rec.Value, getRandomResolver()); err == nil {
+			ns.IPs = addrs.IPs()
+		}
+		servers = append(servers, ns)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+	return servers
+}
+
+// transferZone pulls the whole zone from addr with AXFR, or IXFR from serial 0
+// (which servers answer with a full copy) when qtype is TypeIXFR
+func transferZone(domain, addr string, qtype uint16) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	if qtype == dns.TypeIXFR {
+		m.SetIxfr(dns.Fqdn(domain), 0, ".", ".")
+	} else {
+		m.SetAxfr(dns.Fqdn(domain))
+	}
+
+	tr := &dns.Transfer{DialTimeout: dnsTimeout, ReadTimeout: 10 * time.Second}
+	envelopes, err := tr.In(m, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []dns.RR
+	for env := range envelopes {
+		if env.Error != nil {
+			return records, env.Error
+		}
+		records = append(records, env.RR...)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty transfer")
+	}
+	return records, nil
+}
+
+// attemptZoneTransfer tries AXFR, then IXFR, against every authoritative
+// server. The first successful transfer is registered with source "AXFR" and
+// written to the normal outputs. Returns the number of hosts emitted.
+func attemptZoneTransfer(cfg *scanConfig, domain, port string) int {
+	servers := lookupNameservers(domain)
+	if len(servers) == 0 {
+		if !cfg.Silent {
+			fmt.Printf("[-] No NS records found for %s\n", domain)
+		}
+		return 0
+	}
+
+	for _, ns := range servers {
+		for _, ip := range ns.IPs {
+			addr := net.JoinHostPort(ip, port)
+			for _, qtype := range []uint16{dns.TypeAXFR, dns.TypeIXFR} {
+				records, err := transferZone(domain, addr, qtype)
+				if err != nil {
+					if !cfg.Silent {
+						fmt.Printf("[-] %s %s (%s): %v\n", dns.TypeToString[qtype], ns.Name, addr, err)
+					}
+					continue
+				}
+				if !cfg.Silent {
+					fmt.Printf("\033[1m\033[31m[!] %s ALLOWED:\033[0m %s (%s) returned %d records\n", dns.TypeToString[qtype], ns.Name, addr, len(records))
+				}
+				return registerZoneRecords(cfg, domain, ns.Name, records)
+			}
+		}
+	}
+	return 0
+}
+
+// registerZoneRecords emits every in-zone host from a transfer. CNAMEs are
+// followed through the transferred records first and resolved live otherwise.
+func registerZoneRecords(cfg *scanConfig, domain, nsName string, records []dns.RR) int {
+	addrs := make(map[string][]string)
+	cnames := make(map[string]string)
+	for _, rr := range records {
+		name := strings.TrimSuffix(strings.ToLower(rr.Header().Name), ".")
+		switch v := rr.(type) {
+		case *dns.A:
+			addrs[name] = append(addrs[name], v.A.String())
+		case *dns.AAAA:
+			addrs[name] = append(addrs[name], v.AAAA.String())
+		case *dns.CNAME:
+			cnames[name] = strings.TrimSuffix(strings.ToLower(v.Target), ".")
+		}
+	}
+
+	hosts := make(map[string][]string)
+	for name, ips := range addrs {
+		hosts[name] = ips
+	}
+	for name, target := range cnames {
+		for hops := 0; hops < 8 && target != ""; hops++ {
+			if ips, ok := addrs[target]; ok {
+				hosts[name] = ips
+				break
+			}
+			target = cnames[target]
+		}
+		if _, ok := hosts[name]; !ok {
+			if cfg.Limiter != nil {
+				<-cfg.Limiter
+			}
+			if res, err := lookupHost(name, getRandomResolver()); err == nil && res.Exists() {
+				hosts[name] = res.IPs()
+			}
+		}
+	}
+
+	var names []string
+	for name := range hosts {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	emitted := 0
+	for _, name := range names {
+		// Wildcard owners aren't real hosts, but show where the wildcard points
+		if strings.HasPrefix(name, "*.") {
+			if !cfg.Silent {
+				fmt.Printf("\033[33m[+] Zone wildcard:\033[0m %s -> %s\n", name, strings.Join(hosts[name], ", "))
+			}
+			continue
+		}
+		if emitFound(cfg, name, hosts[name], nsName, "AXFR") {
+			emitted++
+		}
+	}
+	return emitted
+}
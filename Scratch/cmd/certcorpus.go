@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// certExtensions are the files picked up when -certs is a directory
+var certExtensions = map[string]bool{".pem": true, ".crt": true, ".cer": true, ".der": true, ".json": true, ".jsonl": true}
+
+// certCorpusSource ingests a local certificate corpus. It needs no network, so it
+// also runs in -offline mode.
+type certCorpusSource struct {
+	path string // certificates collected outside of CT: PEM/DER files or CT JSON exports
+}
+
+func init() { registerSource(&certCorpusSource{}) }
+
+// configure takes the corpus location from -certs
+func (s *certCorpusSource) configure(opts sourceOptions) { s.path = opts.CertsPath }
+
+func (s *certCorpusSource) Name() string { return "certs" }
+
+// Configured reports whether -certs was given
+func (s *certCorpusSource) Configured() bool { return s.path != "" }
+
+// Enumerate reads every certificate under -certs and reports CN/SAN names and IP SANs.
+// Unreadable files are skipped and reported in the returned error.
+func (s *certCorpusSource) Enumerate(ctx context.Context, domain string, out chan<- SourceResult) error {
+	if s.path == "" {
+		return fmt.Errorf("no -certs path given")
+	}
+
+	var files []string
+	err := filepath.WalkDir(s.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// A file named on the command line is always read; inside a directory, only known extensions
+		if path == s.path || certExtensions[strings.ToLower(filepath.Ext(path))] {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, path := range files {
+		results, err := parseCertFile(path, domain)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", filepath.Base(path), err))
+			continue
+		}
+		if err := sendResults(ctx, out, results); err != nil {
+			return err
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d file(s) unreadable (%s)", len(failed), len(files), failed[0])
+	}
+	return nil
+}
+
+// parseCertFile sniffs a file as PEM, CT JSON (array or JSON Lines) or DER
+func parseCertFile(path, domain string) ([]SourceResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		var results []SourceResult
+		for rest := trimmed; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, certResults(cert, domain)...)
+		}
+		return results, nil
+
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		var entries []crtshEntry
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, err
+		}
+		var results []SourceResult
+		for _, e := range entries {
+			results = append(results, e.results()...)
+		}
+		return results, nil
+
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		var results []SourceResult
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var e crtshEntry
+			if err := json.Unmarshal(line, &e); err != nil {
+				return nil, err
+			}
+			results = append(results, e.results()...)
+		}
+		return results, scanner.Err()
+
+	default:
+		certs, err := x509.ParseCertificates(data)
+		if err != nil {
+			return nil, err
+		}
+		var results []SourceResult
+		for _, cert := range certs {
+			results = append(results, certResults(cert, domain)...)
+		}
+		return results, nil
+	}
+}
+
+// certResults turns a parsed certificate into name results plus IP results.
+// IP SANs are tied to the first in-scope name on the same certificate.
+func certResults(cert *x509.Certificate, domain string) []SourceResult {
+	sum := sha256.Sum256(cert.Raw)
+	info := &CertInfo{
+		ID:        hex.EncodeToString(sum[:8]),
+		Issuer:    cert.Issuer.CommonName,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+	if info.Issuer == "" && len(cert.Issuer.Organization) > 0 {
+		info.Issuer = cert.Issuer.Organization[0]
+	}
+
+	names := cert.DNSNames
+	if cert.Subject.CommonName != "" {
+		names = append([]string{cert.Subject.CommonName}, names...)
+	}
+
+	var results []SourceResult
+	owner := ""
+	for _, name := range names {
+		if owner == "" {
+			if n, wildcard, ok := normalizeName(name, domain); ok && !wildcard {
+				owner = n
+			}
+		}
+		results = append(results, SourceResult{Name: name, Cert: info})
+	}
+	if owner != "" {
+		for _, ip := range cert.IPAddresses {
+			results = append(results, SourceResult{Name: owner, IP: ip.String(), Cert: info})
+		}
+	}
+	return results
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertCorpusReadsDirectory(t *testing.T) {
+	src := &certCorpusSource{}
+	src.configure(sourceOptions{CertsPath: "../../testenv/certs"})
+	if !src.Configured() {
+		t.Fatal("source not configured by -certs")
+	}
+	run := runSources([]Source{src}, "local.test", 5*time.Second, nil)
+	if err := run.Stats[0].Err; err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"cdn.local.test", "intranet.local.test", "origin-old.local.test", "origin.local.test", "portal.local.test", "static.local.test", "vpn.local.test"}
+	if got := run.sorted(); !slices.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	if got := run.hints(); !slices.Equal(got, []string{"intranet.local.test", "static.local.test"}) {
+		t.Errorf("wildcard hints = %v", got)
+	}
+	// The IP SAN belongs to the certificate's first in-scope name
+	if host := run.IPs["192.0.2.50"]; host != "portal.local.test" {
+		t.Errorf("192.0.2.50 attributed to %q, want portal.local.test", host)
+	}
+}
+
+func TestParseCertFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	pemData, err := os.ReadFile("../../testenv/certs/portal.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(pemData)
+	jsonl := `{"id": 1, "issuer_name": "CN=R3", "common_name": "a.local.test", "name_value": "a.local.test\nb.local.test"}` + "\n" +
+		`{"id": 2, "issuer_name": "CN=R3", "common_name": "c.local.test", "name_value": "c.local.test"}` + "\n"
+
+	tests := []struct {
+		file  string
+		data  []byte
+		names []string
+		err   bool
+	}{
+		{"portal.der", block.Bytes, []string{"portal.local.test", "portal.local.test", "vpn.local.test", "*.intranet.local.test", "mail.partner.example", "portal.local.test"}, false},
+		{"export.jsonl", []byte(jsonl), []string{"a.local.test", "b.local.test", "a.local.test", "c.local.test", "c.local.test"}, false},
+		{"broken.pem", []byte("-----BEGIN CERTIFICATE-----\nbm90IGEgY2VydA==\n-----END CERTIFICATE-----\n"), nil, true},
+		{"junk.crt", []byte("not a certificate"), nil, true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.file)
+		if err := os.WriteFile(path, tt.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		results, err := parseCertFile(path, "local.test")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error = %v, want error %v", tt.file, err, tt.err)
+			continue
+		}
+		var names []string
+		for _, r := range results {
+			names = append(names, r.Name)
+		}
+		if !slices.Equal(names, tt.names) {
+			t.Errorf("%s: names = %v, want %v", tt.file, names, tt.names)
+		}
+	}
+}
+
+func TestCertCorpusReportsUnreadableFiles(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{
+		"good.json": `[{"id": 1, "common_name": "a.local.test", "name_value": "a.local.test"}]`,
+		"bad.pem":   "garbage",
+		"notes.txt": "skipped: unknown extension",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	src := &certCorpusSource{path: dir}
+	run := runSources([]Source{src}, "local.test", 5*time.Second, nil)
+	err := run.Stats[0].Err
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 file(s) unreadable (bad.pem") {
+		t.Errorf("error = %v, want bad.pem reported as 1 of 2 files", err)
+	}
+	// Readable files still count
+	if got := run.sorted(); !slices.Equal(got, []string{"a.local.test"}) {
+		t.Errorf("names = %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxChainHops stops tracing CNAME chains that loop or never end
+const maxChainHops = 16
+
+// hopClasses maps CNAME target suffixes to the kind of infrastructure behind them
+var hopClasses = []struct{ Suffix, Class, Provider string }{
+	{"edgekey.net", "CDN", "Akamai"},
+	{"edgesuite.net", "CDN", "Akamai"},
+	{"akamaiedge.net", "CDN", "Akamai"},
+	{"akamaized.net", "CDN", "Akamai"},
+	{"akamai.net", "CDN", "Akamai"},
+	{"cloudfront.net", "CDN", "CloudFront"},
+	{"cdn.cloudflare.net", "CDN", "Cloudflare"},
+	{"fastly.net", "CDN", "Fastly"},
+	{"fastlylb.net", "CDN", "Fastly"},
+	{"azureedge.net", "CDN", "Azure CDN"},
+	{"azurefd.net", "CDN", "Azure Front Door"},
+	{"b-cdn.net", "CDN", "Bunny"},
+	{"cdn77.org", "CDN", "CDN77"},
+	{"llnwd.net", "CDN", "Edgio"},
+	{"edgecastcdn.net", "CDN", "Edgio"},
+	{"footprint.net", "CDN", "Lumen"},
+	{"kxcdn.com", "CDN", "KeyCDN"},
+	{"cachefly.net", "CDN", "CacheFly"},
+	{"stackpathdns.com", "CDN", "StackPath"},
+	{"googleusercontent.com", "CDN", "Google Cloud"},
+	{"incapdns.net", "WAF", "Imperva"},
+	{"impervadns.net", "WAF", "Imperva"},
+	{"sucuri.net", "WAF", "Sucuri"},
+	{"sucuridns.com", "WAF", "Sucuri"},
+	{"wafdns.net", "WAF", "Barracuda"},
+	{"f5silverline.com", "WAF", "F5 Silverline"},
+	{"edgenext.net", "WAF", "EdgeNext"},
+	{"elb.amazonaws.com", "Cloud LB", "AWS ELB"},
+	{"elasticbeanstalk.com", "Cloud LB", "AWS Elastic Beanstalk"},
+	{"awsglobalaccelerator.com", "Cloud LB", "AWS Global Accelerator"},
+	{"cloudapp.azure.com", "Cloud LB", "Azure"},
+	{"cloudapp.net", "Cloud LB", "Azure"},
+	{"trafficmanager.net", "Cloud LB", "Azure Traffic Manager"},
+	{"azurewebsites.net", "Cloud LB", "Azure App Service"},
+	{"appspot.com", "Cloud LB", "Google App Engine"},
+	{"ondigitalocean.app", "Cloud LB", "DigitalOcean"},
+	{"github.io", "SaaS", "GitHub Pages"},
+	{"herokuapp.com", "SaaS", "Heroku"},
+	{"herokudns.com", "SaaS", "Heroku"},
+	{"netlify.app", "SaaS", "Netlify"},
+	{"vercel-dns.com", "SaaS", "Vercel"},
+	{"myshopify.com", "SaaS", "Shopify"},
+	{"zendesk.com", "SaaS", "Zendesk"},
+	{"hubspot.net", "SaaS", "HubSpot"},
+	{"hs-sites.com", "SaaS", "HubSpot"},
+	{"force.com", "SaaS", "Salesforce"},
+	{"statuspage.io", "SaaS", "Statuspage"},
+	{"ghs.googlehosted.com", "SaaS", "Google Sites"},
+	{"wpengine.com", "SaaS", "WP Engine"},
+	{"squarespace.com", "SaaS", "Squarespace"},
+	{"wixdns.net", "SaaS", "Wix"},
+	{"webflow.com", "SaaS", "Webflow"},
+	{"pantheonsite.io", "SaaS", "Pantheon"},
+	{"ghost.io", "SaaS", "Ghost"},
+	{"readme.io", "SaaS", "ReadMe"},
+}
+
+// cnameHop is one alias target in a host's chain, with what it was recognized as
+type cnameHop struct {
+	Name     string
+	Class    string // CDN, WAF, Cloud LB, SaaS or "" when unknown
+	Provider string
+}
+
+// classifyHop tags a CNAME target by suffix
+func classifyHop(name string) cnameHop {
+	hop := cnameHop{Name: name}
+	for _, c := range hopClasses {
+		if inZone(name, c.Suffix) {
+			hop.Class, hop.Provider = c.Class, c.Provider
+			break
+		}
+	}
+	return hop
+}
+
+// traceCNAME follows target's aliases one CNAME query at a time, so every hop
+// is seen even when a resolver flattens part of the chain. Each query spends a
+// -qps token. The result is stored
+// with the host in the asset store; hosts already traced are answered from it.
+func traceCNAME(target string) []cnameHop {
+	if hops, traced := assets.tracedChain(target); traced {
+		return hops
+	}
+
+	var hops []cnameHop
+	seen := map[string]bool{target: true}
+	for name := target; len(hops) < maxChainHops; {
+		next, local := localAlias(name)
+		if !local {
+			if offlineMode {
+				break
+			}
+			if queryLimiter != nil {
+				<-queryLimiter
+			}
+			res, err := queryDNS(name, dns.TypeCNAME, getRandomResolver())
+			if err != nil {
+				break
+			}
+			for _, rec := range res.Answers {
+				if rec.Type == "CNAME" && strings.EqualFold(strings.TrimSuffix(rec.Name, "."), name) {
+					next = rec.Value
+					break
+				}
+			}
+		}
+		if next == "" || seen[next] {
+			break
+		}
+		seen[next] = true
+		hops = append(hops, classifyHop(next))
+		name = next
+	}
+
+	assets.setChain(target, hops)
+	return hops
+}
+
+// traceIfAliased traces res's host when the answer shows it is an alias
+func traceIfAliased(target string, res *DNSResult) {
+	if res != nil && len(res.CNAMEChain()) > 0 {
+		traceCNAME(target)
+	}
+}
+
+// formatChain renders "host -> hop -> hop" for files and plain output
+func formatChain(host string, hops []cnameHop) string {
+	parts := []string{host}
+	for _, hop := range hops {
+		parts = append(parts, hop.Name)
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// describeChain renders the chain for the console, tagging classified hops
+func describeChain(host string, hops []cnameHop) string {
+	parts := []string{host}
+	for _, hop := range hops {
+		if hop.Class == "" {
+			parts = append(parts, hop.Name)
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s \033[35m[%s: %s]\033[0m", hop.Name, hop.Class, hop.Provider))
+	}
+	return strings.Join(parts, " -> ")
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// checkpointVersion is bumped whenever the file layout changes
+const checkpointVersion = 2
+
+// foundEntry is a host emitted during the scan, kept so a resumed run doesn't emit it again
+type foundEntry struct {
+	Host     string   `json:"host"`
+	IPs      []string `json:"ips"`
+	Resolver string   `json:"resolver"`
+	Source   string   `json:"source"`
+}
+
+// checkpointState is what goes on disk
+type checkpointState struct {
+	Version   int                             `json:"version"`
+	Domain    string                          `json:"domain"`
+	Wordlist  string                          `json:"wordlist"`
+	Words     int                             `json:"words"`
+	Position  int                             `json:"position"` // wordlist entries fully processed, from the start
+	Phases    []string                        `json:"phases"`   // completed phases, in order
+	Wildcards map[string]*wildcardFingerprint `json:"wildcards"`
+	Found     []foundEntry                    `json:"found"`
+	Assets    []evidence                      `json:"assets"` // as of the last completed phase
+	Updated   time.Time                       `json:"updated"`
+}
+
+// checkpoint tracks scan progress and writes it to path. All methods are safe
+// on a nil checkpoint, so callers don't need to care whether checkpoints are on.
+type checkpoint struct {
+	path      string
+	wildcards *wildcardCache
+
+	mu     sync.Mutex
+	state  checkpointState
+	done   map[int]bool // wordlist positions finished out of order
+	saveMu sync.Mutex   // serializes writers of the temp file
+}
+
+// newCheckpoint starts an empty checkpoint for a scan of domain with wordlist
+func newCheckpoint(path, domain, wordlist string) *checkpoint {
+	return &checkpoint{
+		path: path,
+		done: make(map[int]bool),
+		state: checkpointState{
+			Version:  checkpointVersion,
+			Domain:   domain,
+			Wordlist: wordlist,
+		},
+	}
+}
+
+// loadCheckpoint reads a checkpoint written by an earlier run of the same scan
+func loadCheckpoint(path, domain, wordlist string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := newCheckpoint(path, domain, wordlist)
+	if err := json.Unmarshal(data, &c.state); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint %s: %v", path, err)
+	}
+	switch {
+	case c.state.Version != checkpointVersion:
+		return nil, fmt.Errorf("checkpoint %s has version %d, expected %d", path, c.state.Version, checkpointVersion)
+	case c.state.Domain != domain:
+		return nil, fmt.Errorf("checkpoint %s is for %s, not %s", path, c.state.Domain, domain)
+	case c.state.Wordlist != wordlist:
+		return nil, fmt.Errorf("checkpoint %s was taken with wordlist %s, not %s", path, c.state.Wordlist, wordlist)
+	}
+	return c, nil
+}
+
+// restoreWildcards seeds wildcards with the saved fingerprints and keeps the
+// cache so later saves include levels fingerprinted since
+func (c *checkpoint) restoreWildcards(wildcards *wildcardCache) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wildcards.restore(c.state.Wildcards)
+	c.wildcards = wildcards
+}
+
+// restore puts a resumed scan back where it stopped: the asset store and the
+// found set, so known hosts are not emitted again
+func (c *checkpoint) restore(cfg *scanConfig) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assets.load(c.state.Assets)
+	for _, f := range c.state.Found {
+		cfg.FoundItems.Store(f.Host, true)
+		cfg.FoundItems.Store(fmt.Sprintf("%s-%v", f.Host, f.IPs), true)
+		if jsonOut != nil {
+			jsonOut.hosts[f.Host] = true
+		}
+		// Hosts found after the last completed phase aren't in the snapshot yet
+		for _, ip := range f.IPs {
+			assets.addAddress(f.Host, ip, f.Source)
+		}
+	}
+}
+
+// progress renders the wordlist position; the total is only known once the
+// streamed wordlist has been read to the end
+func (s *checkpointState) progress() string {
+	if s.Words == 0 {
+		return fmt.Sprintf("word %d", s.Position)
+	}
+	return fmt.Sprintf("word %d/%d", s.Position, s.Words)
+}
+
+// summary describes what a resumed scan starts from
+func (c *checkpoint) summary() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return fmt.Sprintf("%d phase(s) done, %s, %d host(s) found", len(c.state.Phases), c.state.progress(), len(c.state.Found))
+}
+
+// position returns how many wordlist entries a resumed scan can skip
+func (c *checkpoint) position() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Position
+}
+
+// setWords records the wordlist size once it is known, for progress reporting
+func (c *checkpoint) setWords(n int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.Words = n
+	c.mu.Unlock()
+}
+
+// wordDone marks wordlist entry seq (1-based) as processed. Workers finish out
+// of order, so the saved position only advances over a contiguous run.
+func (c *checkpoint) wordDone(seq int) {
+	if c == nil || seq == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.done[seq] = true
+	for c.done[c.state.Position+1] {
+		delete(c.done, c.state.Position+1)
+		c.state.Position++
+	}
+}
+
+// addFound records a host the first time it is emitted
+func (c *checkpoint) addFound(host string, ips []string, resolver, source string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state.Found = append(c.state.Found, foundEntry{Host: host, IPs: ips, Resolver: resolver, Source: source})
+	c.mu.Unlock()
+}
+
+// found returns the hosts found at the given depth below domain, as scan jobs
+func (c *checkpoint) found(domain string, depth int) []scanJob {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var jobs []scanJob
+	for _, f := range c.state.Found {
+		if inZone(f.Host, domain) && f.Host != domain && strings.Count(strings.TrimSuffix(f.Host, "."+domain), ".")+1 == depth {
+			jobs = append(jobs, scanJob{Target: f.Host, Depth: depth})
+		}
+	}
+	return jobs
+}
+
+// completed reports whether a resumed scan already finished phase
+func (c *checkpoint) completed(phase string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Contains(c.state.Phases, phase)
+}
+
+// finishPhase marks phase complete, snapshots the asset store and saves
+func (c *checkpoint) finishPhase(phase string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if !slices.Contains(c.state.Phases, phase) {
+		c.state.Phases = append(c.state.Phases, phase)
+	}
+	c.state.Assets = assets.snapshot()
+	c.mu.Unlock()
+	c.save()
+}
+
+// save writes the checkpoint atomically (temp file + rename)
+func (c *checkpoint) save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if c.wildcards != nil {
+		c.state.Wildcards = c.wildcards.snapshot()
+	}
+	c.state.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(&c.state, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// autosave saves every interval and on SIGINT/SIGTERM; after a signal it saves
+// one last time, runs cleanup (deferred calls don't run on exit) and exits so
+// the scan can be picked up with -resume. The returned function stops it once
+// the scan moves on to another domain.
+func (c *checkpoint) autosave(interval time.Duration, silent bool, cleanup func()) func() {
+	if c == nil {
+		return func() {}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+	quit := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-quit:
+				return
+			case <-tick:
+				if err := c.save(); err != nil && !silent {
+					fmt.Printf("\r\033[K[!] Checkpoint save failed: %v\n", err)
+				}
+			case <-sigs:
+				c.mu.Lock()
+				progress := c.state.progress()
+				c.mu.Unlock()
+				err := c.save()
+				if !silent {
+					fmt.Print("\r\033[K")
+					if err != nil {
+						fmt.Printf("[!] Interrupted; checkpoint save failed: %v\n", err)
+					} else {
+						fmt.Printf("[!] Interrupted at %s; checkpoint saved to %s (rerun with -resume)\n", progress, c.path)
+					}
+				}
+				cleanup()
+				os.Exit(130)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		if ticker != nil {
+			ticker.Stop()
+		}
+		close(quit)
+	}
+}
+
+// remove deletes the checkpoint once the whole run has completed
+func (c *checkpoint) remove() {
+	if c == nil {
+		return
+	}
+	os.Remove(c.path)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWordDoneAdvancesOverContiguousRun(t *testing.T) {
+	tests := []struct {
+		done []int
+		want int
+	}{
+		{[]int{1, 2, 3}, 3},
+		{[]int{2, 3}, 0},
+		{[]int{3, 1, 2}, 3},
+		{[]int{1, 3, 4}, 1},
+		{[]int{1, 3, 4, 2}, 4},
+		{[]int{0, 1}, 1}, // untracked jobs don't move the position
+	}
+	for _, tt := range tests {
+		c := newCheckpoint("unused", "example.com", "words.txt")
+		for _, seq := range tt.done {
+			c.wordDone(seq)
+		}
+		if got := c.position(); got != tt.want {
+			t.Errorf("wordDone(%v): position = %d, want %d", tt.done, got, tt.want)
+		}
+	}
+}
+
+func TestNilCheckpoint(t *testing.T) {
+	var c *checkpoint
+	c.wordDone(1)
+	c.addFound("www.example.com", nil, "", "")
+	c.finishPhase("wordlist")
+	if c.position() != 0 || c.completed("wordlist") || c.found("example.com", 1) != nil || c.save() != nil {
+		t.Error("nil checkpoint recorded progress")
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.checkpoint")
+	assets = newAssetStore(64)
+	c := newCheckpoint(path, "example.com", "words.txt")
+	c.wordDone(1)
+	c.addFound("www.example.com", []string{"192.0.2.1"}, "mock", "Wordlist")
+	c.addFound("a.dev.example.com", []string{"192.0.2.2"}, "mock", "Wordlist")
+	c.finishPhase("wordlist")
+
+	tests := []struct {
+		name, domain, wordlist, err string
+	}{
+		{"same scan", "example.com", "words.txt", ""},
+		{"other domain", "example.org", "words.txt", "is for example.com"},
+		{"other wordlist", "example.com", "big.txt", "taken with wordlist words.txt"},
+	}
+	for _, tt := range tests {
+		loaded, err := loadCheckpoint(path, tt.domain, tt.wordlist)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !loaded.completed("wordlist") || loaded.completed("recursion") || loaded.position() != 1 {
+			t.Errorf("%s: loaded %s", tt.name, loaded.summary())
+		}
+		if got := loaded.found("example.com", 1); len(got) != 1 || got[0].Target != "www.example.com" {
+			t.Errorf("%s: depth 1 hosts = %v", tt.name, got)
+		}
+		if got := loaded.found("example.com", 2); len(got) != 1 || got[0].Target != "a.dev.example.com" {
+			t.Errorf("%s: depth 2 hosts = %v", tt.name, got)
+		}
+	}
+}
+
+// csvHosts returns the subdomains written to a scan's CSV output
+func csvHosts(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for _, r := range records[1:] {
+		hosts = append(hosts, r[0])
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+func TestResumeSkipsFinishedWorkAndFoundHosts(t *testing.T) {
+	hosts, err := loadHostsFile("../../testenv/hosts.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedHosts, savedOffline := localHosts, offlineMode
+	localHosts, offlineMode = hosts, true
+	t.Cleanup(func() { localHosts, offlineMode = savedHosts, savedOffline })
+
+	wordlistPath, err := filepath.Abs("../../testenv/wordlist.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		position int
+		phases   []string
+		want     []string
+	}{
+		// www was found before the interruption and is not written again
+		{"found host", 0, nil, []string{"api.local.test", "blog.local.test", "cdn.local.test", "dev.local.test", "origin.local.test", "static.local.test"}},
+		// www and api were processed, so the brute force starts at origin
+		{"mid wordlist", 2, nil, []string{"blog.local.test", "cdn.local.test", "dev.local.test", "origin.local.test", "static.local.test"}},
+		// the brute force finished, so nothing new comes from the wordlist
+		{"wordlist phase done", 9, []string{"wordlist"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			words, err := newWordlist([]string{wordlistPath}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer words.close()
+
+			c := newCheckpoint("local.test_recon.checkpoint", "local.test", wordlistPath)
+			c.state.Position = tt.position
+			c.state.Phases = tt.phases
+			c.addFound("www.local.test", []string{"127.0.0.1"}, "LocalHosts", "Wordlist")
+			if err := c.save(); err != nil {
+				t.Fatal(err)
+			}
+
+			ckpt := scanDomain("local.test", &scanOptions{
+				Resume:          true,
+				WordlistSources: wordlistPath,
+				Words:           words,
+				V6Prefix:        64,
+				Threads:         2,
+				Silent:          true,
+				Formats:         map[string]bool{"csv": true},
+			})
+			if ckpt == nil || !ckpt.completed("done") {
+				t.Fatal("resumed scan did not finish")
+			}
+			if got := csvHosts(t, "local.test_recon.csv"); !slices.Equal(got, tt.want) {
+				t.Errorf("written hosts = %v, want %v", got, tt.want)
+			}
+			if !assets.hasHost("www.local.test") {
+				t.Error("host found before the interruption missing from the asset store")
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// crtshSource queries crt.sh's certificate transparency search
+type crtshSource struct {
+	client  *http.Client
+	baseURL string // crt.sh or a stand-in for offline tests
+}
+
+func init() { registerSource(&crtshSource{client: &http.Client{}}) }
+
+// configure points the source at -crtsh-url
+func (s *crtshSource) configure(opts sourceOptions) { s.baseURL = opts.CrtshURL }
+
+func (s *crtshSource) Name() string { return "crtsh" }
+
+// Enumerate fetches every logged certificate matching %.domain
+func (s *crtshSource) Enumerate(ctx context.Context, domain string, out chan<- SourceResult) error {
+	endpoint := strings.TrimSuffix(s.baseURL, "/") + "/?q=" + url.QueryEscape("%."+domain) + "&output=json"
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("crt.sh status %d", resp.StatusCode)
+	}
+
+	var entries []crtshEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := sendResults(ctx, out, e.results()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// crtshEntry is one certificate in crt.sh's JSON output (also the usual CT export format)
+type crtshEntry struct {
+	ID         int64  `json:"id"`
+	IssuerName string `json:"issuer_name"`
+	CommonName string `json:"common_name"`
+	NameValue  string `json:"name_value"`
+	NotBefore  string `json:"not_before"`
+	NotAfter   string `json:"not_after"`
+}
+
+// results expands an entry into one result per name, sharing its metadata
+func (e *crtshEntry) results() []SourceResult {
+	cert := &CertInfo{
+		ID:        strconv.FormatInt(e.ID, 10),
+		Issuer:    issuerCN(e.IssuerName),
+		NotBefore: parseCrtshTime(e.NotBefore),
+		NotAfter:  parseCrtshTime(e.NotAfter),
+	}
+	// name_value holds every SAN, one per line; the CN is usually among them
+	names := strings.Split(e.NameValue, "\n")
+	if e.CommonName != "" {
+		names = append(names, e.CommonName)
+	}
+	var results []SourceResult
+	for _, name := range names {
+		// IP SANs show up in name_value as bare addresses
+		if ip := parseAddr(strings.TrimSpace(name)); ip != nil {
+			results = append(results, SourceResult{Name: e.CommonName, IP: ip.String(), Cert: cert})
+			continue
+		}
+		results = append(results, SourceResult{Name: name, Cert: cert})
+	}
+	return results
+}
+
+// parseCrtshTime reads crt.sh's zone-less timestamps (UTC), with or without fractions
+func parseCrtshTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// issuerCN shortens a distinguished name to its CN (or O) for display
+func issuerCN(dn string) string {
+	fallback := strings.TrimSpace(dn)
+	for _, part := range strings.Split(dn, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "CN":
+			return value
+		case "O":
+			fallback = value
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		raw      string
+		name     string
+		wildcard bool
+		ok       bool
+	}{
+		{"WWW.Example.com.", "www.example.com", false, true},
+		{" api.example.com ", "api.example.com", false, true},
+		{"*.dev.example.com", "dev.example.com", true, true},
+		{"*.example.com", "example.com", true, true},
+		{"_dmarc.example.com", "_dmarc.example.com", false, true},
+		{"admin@example.com", "", false, false},
+		{"192.0.2.1", "", false, false},
+		{"www.example.org", "", false, false},
+		{"notexample.com", "", false, false},
+		{"bad_label!.example.com", "", false, false},
+		{"-dash.example.com", "", false, false},
+		{"", "", false, false},
+	}
+	for _, tt := range tests {
+		name, wildcard, ok := normalizeName(tt.raw, "example.com")
+		if name != tt.name || wildcard != tt.wildcard || ok != tt.ok {
+			t.Errorf("normalizeName(%q) = %q, %v, %v; want %q, %v, %v", tt.raw, name, wildcard, ok, tt.name, tt.wildcard, tt.ok)
+		}
+	}
+}
+
+func TestIssuerCN(t *testing.T) {
+	tests := []struct{ dn, want string }{
+		{"C=US, O=Let's Encrypt, CN=R3", "R3"},
+		{"C=US, O=DigiCert Inc", "DigiCert Inc"},
+		{"Unparsed Issuer", "Unparsed Issuer"},
+	}
+	for _, tt := range tests {
+		if got := issuerCN(tt.dn); got != tt.want {
+			t.Errorf("issuerCN(%q) = %q, want %q", tt.dn, got, tt.want)
+		}
+	}
+}
+
+func TestCrtshSourceScopesResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "%.local.test" || r.URL.Query().Get("output") != "json" {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		http.ServeFile(w, r, "../../testenv/certs/ct-export.json")
+	}))
+	defer server.Close()
+
+	src := &crtshSource{client: server.Client()}
+	src.configure(sourceOptions{CrtshURL: server.URL + "/"})
+	run := runSources([]Source{src}, "local.test", 5*time.Second, nil)
+
+	stats := run.Stats[0]
+	if stats.Err != nil {
+		t.Fatal(stats.Err)
+	}
+	if got, want := run.sorted(), []string{"cdn.local.test", "origin-old.local.test", "origin.local.test", "static.local.test"}; !slices.Equal(got, want) {
+		t.Errorf("names = %v, want %v", got, want)
+	}
+	if got := run.hints(); !slices.Equal(got, []string{"static.local.test"}) {
+		t.Errorf("wildcard hints = %v", got)
+	}
+	// admin@local.test is dropped; *.static.local.test counts as its parent
+	if stats.Filtered != 1 || stats.Unique != 4 {
+		t.Errorf("stats = %+v, want 1 filtered and 4 unique", stats)
+	}
+
+	certs := run.Certs["origin-old.local.test"]
+	if len(certs) != 1 || certs[0].Issuer != "R3" || !certs[0].expired(time.Now()) {
+		t.Errorf("origin-old.local.test certificates = %+v, want one expired R3 certificate", certs)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsTimeout bounds a single exchange with a resolver
+var dnsTimeout = 2 * time.Second
+
+// DNSRecord is a single resource record from a DNS answer
+type DNSRecord struct {
+	Name  string
+	Type  string
+	TTL   uint32
+	Value string
+}
+
+// DNSResult holds the full response for one query: rcode, answer chain and timing
+type DNSResult struct {
+	Name     string
+	Rcode    int
+	Answers  []DNSRecord
+	Resolver string
+	RTT      time.Duration
+}
+
+// RcodeName returns the textual rcode (NOERROR, NXDOMAIN, SERVFAIL, ...)
+func (r *DNSResult) RcodeName() string {
+	if name, ok := dns.RcodeToString[r.Rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE%d", r.Rcode)
+}
+
+// Exists reports whether the name resolved to at least one record
+func (r *DNSResult) Exists() bool {
+	return r.Rcode == dns.RcodeSuccess && len(r.Answers) > 0
+}
+
+// IPs returns the A/AAAA addresses in answer order
+func (r *DNSResult) IPs() []string {
+	var ips []string
+	for _, rec := range r.Answers {
+		if rec.Type == "A" || rec.Type == "AAAA" {
+			ips = append(ips, rec.Value)
+		}
+	}
+	return ips
+}
+
+// CNAMEChain returns the CNAME targets in the order the resolver followed them
+func (r *DNSResult) CNAMEChain() []string {
+	var chain []string
+	for _, rec := range r.Answers {
+		if rec.Type == "CNAME" {
+			chain = append(chain, rec.Value)
+		}
+	}
+	return chain
+}
+
+// MinTTL returns the lowest TTL in the answer section (0 if empty)
+func (r *DNSResult) MinTTL() uint32 {
+	var min uint32
+	for i, rec := range r.Answers {
+		if i == 0 || rec.TTL < min {
+			min = rec.TTL
+		}
+	}
+	return min
+}
+
+// merge folds the answers of another query for the same name (AAAA after A)
+// into r. CNAMEs already in the chain are not repeated.
+func (r *DNSResult) merge(other *DNSResult) {
+	seen := make(map[string]bool)
+	for _, rec := range r.Answers {
+		seen[rec.Type+" "+rec.Name+" "+rec.Value] = true
+	}
+	for _, rec := range other.Answers {
+		if !seen[rec.Type+" "+rec.Name+" "+rec.Value] {
+			r.Answers = append(r.Answers, rec)
+		}
+	}
+	if len(r.Answers) > 0 {
+		r.Rcode = dns.RcodeSuccess
+	}
+}
+
+// queryDNS sends a single question to resolver and returns the full response.
+// A non-nil error means no usable response (timeout, network error); DNS-level
+// failures such as NXDOMAIN or SERVFAIL are reported through Rcode instead.
+func queryDNS(target string, qtype uint16, resolver string) (*DNSResult, error) {
+	if resolverTransport(resolver) == transportUDP && dnsEngine != nil {
+		return dnsEngine.Exchange(target, qtype, resolver)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(target), qtype)
+	m.RecursionDesired = true
+
+	resp, rtt, err := exchangeMsg(m, resolver)
+	if err != nil {
+		health.observe(resolver, nil, err)
+		return nil, err
+	}
+
+	res := newDNSResult(target, resolver, resp, rtt)
+	health.observe(resolver, res, nil)
+	return res, nil
+}
+
+// exchangeMsg sends a prepared message over the resolver's transport, bypassing
+// the UDP engine. Used when the caller needs the raw reply (authority section, EDNS).
+func exchangeMsg(m *dns.Msg, resolver string) (*dns.Msg, time.Duration, error) {
+	switch resolverTransport(resolver) {
+	case transportDoH:
+		return exchangeDoH(m, resolver)
+	case transportTCP, transportDoT:
+		return exchangeStream(m, resolver)
+	}
+
+	c := &dns.Client{Net: "udp", Timeout: dnsTimeout}
+	resp, rtt, err := c.Exchange(m, resolver)
+
+	// Large answers (long CNAME chains, big TXT sets) come back truncated over UDP
+	if err == nil && resp.Truncated {
+		c.Net = "tcp"
+		if tcpResp, tcpRTT, tcpErr := c.Exchange(m, resolver); tcpErr == nil {
+			resp, rtt = tcpResp, tcpRTT
+		}
+	}
+	return resp, rtt, err
+}
+
+// newDNSResult flattens a dns.Msg into a DNSResult
+func newDNSResult(target, resolverAddr string, resp *dns.Msg, rtt time.Duration) *DNSResult {
+	res := &DNSResult{
+		Name:     strings.TrimSuffix(strings.ToLower(target), "."),
+		Rcode:    resp.Rcode,
+		Resolver: resolverAddr,
+		RTT:      rtt,
+	}
+	for _, rr := range resp.Answer {
+		hdr := rr.Header()
+		res.Answers = append(res.Answers, DNSRecord{
+			Name:  strings.TrimSuffix(strings.ToLower(hdr.Name), "."),
+			Type:  dns.TypeToString[hdr.Rrtype],
+			TTL:   hdr.Ttl,
+			Value: recordValue(rr),
+		})
+	}
+	return res
+}
+
+// recordValue extracts the data portion of a resource record
+func recordValue(rr dns.RR) string {
+	switch v := rr.(type) {
+	case *dns.A:
+		return v.A.String()
+	case *dns.AAAA:
+		return v.AAAA.String()
+	case *dns.CNAME:
+		return strings.TrimSuffix(strings.ToLower(v.Target), ".")
+	case *dns.NS:
+		return strings.TrimSuffix(strings.ToLower(v.Ns), ".")
+	case *dns.PTR:
+		return strings.TrimSuffix(strings.ToLower(v.Ptr), ".")
+	case *dns.MX:
+		return strings.TrimSuffix(strings.ToLower(v.Mx), ".")
+	case *dns.TXT:
+		return strings.Join(v.Txt, "")
+	default:
+		return strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+}
+
+// localResult wraps a hosts-file entry so it looks like a resolver answer.
+// Values that aren't IPs are CNAMEs and are followed through the hosts map the
+// way a recursive resolver would; a chain leaving the map ends in NXDOMAIN.
+func localResult(target string, values []string) *DNSResult {
+	res := &DNSResult{Name: strings.ToLower(target), Rcode: dns.RcodeSuccess, Resolver: "local"}
+	seen := map[string]bool{res.Name: true}
+	for name := res.Name; ; {
+		alias := ""
+		for _, v := range values {
+			ip := net.ParseIP(v)
+			switch {
+			case ip == nil:
+				alias = strings.ToLower(strings.TrimSuffix(v, "."))
+			case ip.To4() != nil:
+				res.Answers = append(res.Answers, DNSRecord{Name: name, Type: "A", Value: v})
+			default:
+				res.Answers = append(res.Answers, DNSRecord{Name: name, Type: "AAAA", Value: v})
+			}
+		}
+		if alias == "" {
+			return res
+		}
+		res.Answers = append(res.Answers, DNSRecord{Name: name, Type: "CNAME", Value: alias})
+		if seen[alias] || len(seen) > maxChainHops {
+			res.Rcode = dns.RcodeServerFailure
+			return res
+		}
+		seen[alias] = true
+		next, ok := lookupLocalHosts(alias)
+		if !ok {
+			res.Rcode = dns.RcodeNameError
+			return res
+		}
+		name, values = alias, next
+	}
+}
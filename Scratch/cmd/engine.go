@@ -1,29 +1,37 @@
 package main
 
 import (
-	"context"
+	"encoding/csv"
+	"encoding/xml"
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/projectdiscovery/cdncheck"
+	"scope"
 )
 
 var fileMutex sync.Mutex
 var cdnClient = cdncheck.New()
 
-// IPInfo tracks IP frequency and source information
-type IPInfo struct {
-	Count   int
-	Domains []string
-	Source  string
-}
+// verifyPositives cross-checks every found host against a second resolver
+var verifyPositives bool
+
+// resolveAAAA adds AAAA lookups alongside A for every resolved host
+var resolveAAAA bool
 
-var registry = make(map[string]*IPInfo)
+// queryLimiter is the shared -qps bucket; lookupHost spends a token of its own
+// on the AAAA query so it doesn't ride on the caller's token for A
+var queryLimiter <-chan struct{}
+
+// inScope is the engagement scope from -scope (nil = unrestricted)
+var inScope *scope.Rules
 
 func newTokenBucket(qps, burst int) <-chan struct{} {
 	if qps <= 0 {
@@ -52,147 +60,278 @@ func newTokenBucket(qps, burst int) <-chan struct{} {
 	return tokens
 }
 
-func lookupHost(target, resolverAddr string) ([]string, string, error) {
+// lookupHost resolves target's A (and, with resolveAAAA, AAAA) records,
+// preferring the local hosts map
+func lookupHost(target, resolverAddr string) (*DNSResult, error) {
 	if ips, ok := lookupLocalHosts(target); ok {
-		return ips, "local", nil
+		return localResult(target, ips), nil
 	}
 	if offlineMode {
-		return nil, resolverAddr, fmt.Errorf("offline mode")
+		return nil, fmt.Errorf("offline mode")
+	}
+
+	res, err := queryDNS(target, dns.TypeA, resolverAddr)
+	if err != nil || !resolveAAAA || res.Rcode == dns.RcodeNameError {
+		return res, err
+	}
+	if queryLimiter != nil {
+		<-queryLimiter
+	}
+	if v6, err := queryDNS(target, dns.TypeAAAA, resolverAddr); err == nil && v6.Rcode == dns.RcodeSuccess {
+		res.merge(v6)
 	}
+	return res, nil
+}
+
+// scanJob is one candidate hostname, how many labels below the apex it sits
+// and which phase produced it (defaults to "Wordlist")
+type scanJob struct {
+	Target string
+	Depth  int
+	Source string
+	Seq    int // 1-based wordlist position tracked for checkpoints, 0 if untracked
+}
+
+// scanConfig carries the settings and shared state every scratchWorker needs
+type scanConfig struct {
+	Domain     string
+	Threads    int
+	Delay      int
+	Jitter     int
+	Limiter    <-chan struct{}
+	FoundItems *sync.Map
+	Counter    *int64
+	Files      map[string]*os.File
+	URLOnly    bool
+	IPOnly     bool
+	Silent     bool
+	FilterCDN  bool
+	Wildcards  *wildcardCache
+	Checkpoint *checkpoint
+	Combined   bool // output files are shared by every -dL domain and keyed by apex
+
+	mu         sync.Mutex
+	discovered []scanJob // hosts first found during the current pass
+}
+
+// runScan starts a worker pool, lets feed push candidates and returns the new
+// hosts found once every worker has drained the queue
+func runScan(cfg *scanConfig, feed func(jobs chan<- scanJob)) []scanJob {
+	jobs := make(chan scanJob)
+	var wg sync.WaitGroup
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	cfg.mu.Lock()
+	cfg.discovered = nil
+	cfg.mu.Unlock()
 
-	r := &net.Resolver{
-		PreferGo: true,
-		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-			d := net.Dialer{Timeout: 2 * time.Second}
-			return d.DialContext(ctx, "udp", resolverAddr)
-		},
+	for i := 0; i < cfg.Threads; i++ {
+		wg.Add(1)
+		go scratchWorker(cfg, jobs, &wg)
 	}
 
-	ips, err := r.LookupHost(ctx, target)
-	return ips, resolverAddr, err
+	feed(jobs)
+	close(jobs) // Tell workers no more data is coming
+	wg.Wait()   // Wait for them to finish current tasks
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	return cfg.discovered
 }
 
-func scratchWorker(domain string, jobs <-chan string, wg *sync.WaitGroup, delay, jitter int, limiter <-chan struct{}, foundItems *sync.Map, counter *int64, files map[string]*os.File, urlOnly, ipOnly, silent bool, filterCDN bool, wildcardIPs map[string]bool) {
+func scratchWorker(cfg *scanConfig, jobs <-chan scanJob, wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for sub := range jobs {
-		cleanSub := strings.ToLower(strings.TrimSpace(sub))
-		atomic.AddInt64(counter, 1)
+	for job := range jobs {
+		resolveJob(cfg, job)
+		cfg.Checkpoint.wordDone(job.Seq)
+	}
+}
+
+// resolveJob resolves one candidate and emits it if it is a real host
+func resolveJob(cfg *scanConfig, job scanJob) {
+	counter, silent, wildcards := cfg.Counter, cfg.Silent, cfg.Wildcards
+
+	target := strings.ToLower(strings.TrimSpace(job.Target))
+	source := job.Source
+	if source == "" {
+		source = "Wordlist"
+	}
+	atomic.AddInt64(counter, 1)
+
+	// Visual progress feedback
+	if !silent && atomic.LoadInt64(counter)%10 == 0 {
+		fmt.Printf("\r\033[K[*] Probing: %s (%d)", target, atomic.LoadInt64(counter))
+	}
+
+	if cfg.Limiter != nil {
+		<-cfg.Limiter
+	}
+	sleepWithJitter(cfg.Delay, cfg.Jitter)
+	resolverAddr := getRandomResolver()
+
+	res, err := lookupHost(target, resolverAddr)
+
+	// Keep aliases whose target is gone; they are takeover candidates
+	if err == nil && !res.Exists() && !wildcards.matches(target, res) {
+		traceIfAliased(target, res)
+		trackCNAME(target, res, source)
+	}
+
+	// Timeouts and NXDOMAIN/SERVFAIL/REFUSED answers carry no hosts
+	if err == nil && res.Exists() {
+		ips := res.IPs()
+		resolverName := getResolverName(res.Resolver)
 
-		// Visual progress feedback
-		if !silent && atomic.LoadInt64(counter)%10 == 0 {
-			fmt.Printf("\r\033[K[*] Probing: %s.%s (%d)", cleanSub, domain, atomic.LoadInt64(counter))
+		// --- WILDCARD DETECTION ---
+		// If the answer matches the wildcard fingerprint of any parent level, this is a fake subdomain
+		if wildcards.matches(target, res) {
+			return
 		}
 
-		if limiter != nil {
-			<-limiter
+		// Make sure a lying resolver isn't inventing hosts
+		if verifyPositives && !verifyAnswer(target, res) {
+			return
 		}
-		sleepWithJitter(delay, jitter)
-		target := fmt.Sprintf("%s.%s", cleanSub, domain)
-		resolverAddr := getRandomResolver()
-
-		ips, resolverUsed, err := lookupHost(target, resolverAddr)
-
-		if err == nil {
-			resolverName := getResolverName(resolverUsed)
-
-			// --- WILDCARD DETECTION ---
-			// If all IPs returned match the wildcard pool, this is a fake subdomain
-			isWildcardSub := true
-			for _, ip := range ips {
-				if !wildcardIPs[ip] {
-					isWildcardSub = false
-					break
-				}
-			}
-			if isWildcardSub {
-				continue
-			}
 
-			var filteredIPs []string
-			var cdnTags []string
+		traceIfAliased(target, res)
+		trackCNAME(target, res, source)
+		if !emitFound(cfg, target, ips, resolverName, source) {
+			return
+		}
 
-			for _, ip := range ips {
-				matched, val, errStr, _ := cdnClient.Check(net.ParseIP(ip))
-				isCDNProvider := matched && errStr == ""
-				isWildcardIP := wildcardIPs[ip]
+		// Recursion only needs each host once, whatever IPs it came back with
+		if _, seen := cfg.FoundItems.LoadOrStore(target, true); !seen {
+			cfg.mu.Lock()
+			cfg.discovered = append(cfg.discovered, scanJob{Target: target, Depth: job.Depth})
+			cfg.mu.Unlock()
+		}
+	}
+}
 
-				// If filtering, skip known CDNs and the Wildcard/Anycast pool
-				if filterCDN && (isCDNProvider || isWildcardIP) {
-					continue
-				}
+// emitFound tags a resolved host, applies the CDN/wildcard filter and, the first
+// time a host/IP set is seen, prints it, writes it to the output files and
+// registers its IPs. Returns false when filtering left no IPs.
+func emitFound(cfg *scanConfig, target string, ips []string, resolverName, source string) bool {
+	var filteredIPs []string
+	var cdnTags []string
 
-				filteredIPs = append(filteredIPs, ip)
+	for _, c := range classifyIPs(ips, cfg.Wildcards) {
+		// If filtering, skip known CDNs and the Wildcard/Anycast pool
+		if cfg.FilterCDN && !c.Origin {
+			continue
+		}
 
-				// Refined Tagging Logic
-				if isCDNProvider {
-					cdnTags = append(cdnTags, fmt.Sprintf("[%s CDN]", val))
-				} else if isWildcardIP {
-					cdnTags = append(cdnTags, "[\033[33mCDN Anycast/Wildcard\033[0m]")
-				} else {
-					// ONLY tag as TRUE ORIGIN if it passes all filters
-					cdnTags = append(cdnTags, "\033[1m\033[32m[TRUE ORIGIN]\033[0m")
-				}
-			}
+		filteredIPs = append(filteredIPs, c.IP)
 
-			if len(filteredIPs) == 0 {
-				continue
-			}
+		// Refined Tagging Logic
+		if c.CDN != "" {
+			cdnTags = append(cdnTags, fmt.Sprintf("[%s CDN]", c.CDN))
+		} else if c.Wildcard {
+			cdnTags = append(cdnTags, "[\033[33mCDN Anycast/Wildcard\033[0m]")
+		} else {
+			// ONLY tag as TRUE ORIGIN if it passes all filters
+			cdnTags = append(cdnTags, "\033[1m\033[32m[TRUE ORIGIN]\033[0m")
+		}
+	}
 
-			recordKey := fmt.Sprintf("%s-%v", cleanSub, filteredIPs)
-			if _, loaded := foundItems.LoadOrStore(recordKey, true); !loaded {
-				ipDisplay := strings.Join(filteredIPs, ", ")
-				cdnDisplay := strings.Join(cdnTags, ", ")
+	if len(filteredIPs) == 0 {
+		return false
+	}
 
-				if urlOnly {
-					fmt.Println(target)
-				} else if ipOnly {
-					for _, ip := range filteredIPs {
-						fmt.Println(ip)
-					}
-				}
+	recordKey := fmt.Sprintf("%s-%v", target, filteredIPs)
+	if _, loaded := cfg.FoundItems.LoadOrStore(recordKey, true); !loaded {
+		ipDisplay := strings.Join(filteredIPs, ", ")
+		cdnDisplay := strings.Join(cdnTags, ", ")
 
-				if !silent {
-					fmt.Print("\r\033[K")
-					fmt.Printf("\033[32m[+] FOUND:\033[0m %-25s || \033[33mDNS: %-15s\033[0m || \033[36m%s\033[0m || %s\n",
-						target, resolverName, ipDisplay, cdnDisplay)
-				}
+		if cfg.URLOnly {
+			fmt.Println(target)
+		} else if cfg.IPOnly {
+			for _, ip := range filteredIPs {
+				fmt.Println(ip)
+			}
+		}
 
-				if len(files) > 0 {
-					writeToFiles(files, target, filteredIPs, resolverName)
-				}
+		if !cfg.Silent {
+			fmt.Print("\r\033[K")
+			fmt.Printf("\033[32m[+] FOUND:\033[0m %-25s || \033[33mDNS: %-15s\033[0m || \033[36m%s\033[0m || %s\n",
+				target, resolverName, ipDisplay, cdnDisplay)
+			if hops := assets.chainOf(target); len(hops) > 0 {
+				fmt.Printf("  └── %s\n", describeChain(target, hops))
+			}
+		}
 
-				for _, ip := range filteredIPs {
-					registerIP(ip, target, "Wordlist")
-				}
+		for _, ip := range filteredIPs {
+			assets.addAddress(target, ip, source)
+		}
+		cfg.Checkpoint.addFound(target, filteredIPs, resolverName, source)
+
+		// The writers report the host as the store now links it, but only with
+		// the addresses that passed the filters above
+		host := assets.view(target, source)
+		host.IPs = filteredIPs
+		if len(cfg.Files) > 0 {
+			apex := ""
+			if cfg.Combined {
+				apex = cfg.Domain
 			}
+			writeToFiles(cfg.Files, apex, host, resolverName, source)
 		}
+		jsonOut.host(host, cfg.Wildcards, resolverName, source)
 	}
+	return true
 }
 
-// writeToFiles must be outside the scratchWorker function's closing brace
-func writeToFiles(files map[string]*os.File, target string, ips []string, resName string) {
+// xmlHost is one <host> element of the XML report
+type xmlHost struct {
+	XMLName   xml.Name `xml:"host"`
+	Apex      string   `xml:"apex,attr,omitempty"`
+	Subdomain string   `xml:"subdomain"`
+	IPs       string   `xml:"ips"`
+	Resolver  string   `xml:"resolver"`
+	Source    string   `xml:"source"`
+	Chain     string   `xml:"chain,omitempty"`
+}
+
+// writeToFiles must be outside the scratchWorker function's closing brace.
+// apex is only set for combined output, where it leads every record.
+func writeToFiles(files map[string]*os.File, apex string, host hostView, resName, source string) {
 	fileMutex.Lock()
 	defer fileMutex.Unlock()
 
-	// Since ips is now []string, we can join them into a clean string for the files
-	ipStr := strings.Join(ips, ", ")
+	target := host.Name
+	ipStr := strings.Join(host.IPs, ", ")
+	chain := ""
+	if len(host.Chain) > 0 {
+		chain = formatChain(target, host.Chain)
+	}
 
 	if f, ok := files["txt"]; ok {
 		fmt.Fprintln(f, target)
 	}
 	if f, ok := files["csv"]; ok {
-		// CSVs often use quotes for fields containing commas
-		fmt.Fprintf(f, "%s,\"%s\",%s\n", target, ipStr, resName)
+		// encoding/csv quotes fields containing commas, quotes or newlines
+		w := csv.NewWriter(f)
+		record := []string{target, ipStr, resName, source, chain}
+		if apex != "" {
+			record = append([]string{apex}, record...)
+		}
+		w.Write(record)
+		w.Flush()
 	}
 	if f, ok := files["xml"]; ok {
-		fmt.Fprintf(f, "  <host><subdomain>%s</subdomain><ips>%s</ips></host>\n", target, ipStr)
+		if out, err := xml.Marshal(xmlHost{Apex: apex, Subdomain: target, IPs: ipStr, Resolver: resName, Source: source, Chain: chain}); err == nil {
+			fmt.Fprintf(f, "  %s\n", out)
+		}
 	}
 	if f, ok := files["grep"]; ok {
-		fmt.Fprintf(f, "Host: %s\tIPs: %s\tResolver: %s\tSource: %s\n", target, ipStr, resName, "Wordlist")
+		line := fmt.Sprintf("Host: %s\tIPs: %s\tResolver: %s\tSource: %s", target, ipStr, resName, source)
+		if apex != "" {
+			line = "Apex: " + apex + "\t" + line
+		}
+		if chain != "" {
+			line += "\tChain: " + chain
+		}
+		fmt.Fprintln(f, line)
 	}
 }
 
@@ -204,92 +343,111 @@ func filterByFrequency(ips []string, filterCDN bool) []string {
 
 	var filtered []string
 	for _, ip := range ips {
-		if info, exists := registry[ip]; exists && info.Count <= 3 {
+		if n := assets.hostCount(ip); n > 0 && n <= 3 {
 			filtered = append(filtered, ip)
 		}
 	}
 	return filtered
 }
 
-// checkCNAMEChaser analyzes common subdomains for CNAME hops and origin IPs
-func checkCNAMEChaser(domain string, ipOnly, filterCDN bool) {
-	foundIPs := make(map[string]bool)
-	subs := []string{"", "www", "dev", "api", "origin", "staging", "internal", "mail", "portal"}
-
-	for _, s := range subs {
-		target := domain
-		if s != "" {
-			target = s + "." + domain
-		}
-
-		// Look for CNAME hops
-		cname, _ := net.LookupCNAME(target)
-
-		// Resolve IPs
-		ips, err := net.LookupIP(target)
-		if err != nil {
-			continue
-		}
+// chaserResult is one host's resolution as seen by the CNAME chaser
+type chaserResult struct {
+	Host string
+	Hops []cnameHop
+	IPs  []string
+}
 
-		for _, ip := range ips {
-			ipStr := ip.String()
-			if foundIPs[ipStr] {
-				continue
+// checkCNAMEChaser traces the full CNAME chain of every host hop by hop,
+// registers hosts not seen before and prints each chain with its addresses
+func checkCNAMEChaser(cfg *scanConfig, hosts []string, ipOnly, filterCDN bool) {
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var results []chaserResult
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				if cfg.Limiter != nil {
+					<-cfg.Limiter
+				}
+				res, err := lookupHost(target, getRandomResolver())
+				if err != nil {
+					continue
+				}
+				traceIfAliased(target, res)
+				trackCNAME(target, res, "DNS/CNAME")
+				if !res.Exists() || len(res.IPs()) == 0 {
+					continue
+				}
+				if !assets.hasHost(target) {
+					for _, ip := range res.IPs() {
+						assets.addAddress(target, ip, "DNS/CNAME")
+					}
+				}
+				mu.Lock()
+				results = append(results, chaserResult{Host: target, Hops: assets.chainOf(target), IPs: res.IPs()})
+				mu.Unlock()
 			}
-			foundIPs[ipStr] = true
+		}()
+	}
+	for _, host := range hosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
 
-			matched, val, _, _ := cdnClient.Check(ip)
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	foundIPs := make(map[string]bool)
+	for _, r := range results {
+		if !cfg.Silent {
+			if len(r.Hops) > 0 {
+				fmt.Println(describeChain(r.Host, r.Hops))
+			} else {
+				fmt.Printf("%s (A)\n", r.Host)
+			}
+		}
+		for _, ipStr := range r.IPs {
+			matched, val, _, _ := cdnClient.Check(net.ParseIP(ipStr))
 			isCDN := matched
 
 			if ipOnly {
-				if filterCDN && isCDN {
+				if foundIPs[ipStr] || (filterCDN && isCDN) {
 					continue
 				}
+				foundIPs[ipStr] = true
 				fmt.Println(ipStr)
-			} else {
-				// Visual Output
-				tag := "[\033[32mPotential Origin\033[0m]"
-				if isCDN {
-					tag = fmt.Sprintf("[\033[31m%s CDN\033[0m]", val)
-				}
-
-				source := "A"
-				if cname != "" && cname != target+"." {
-					source = fmt.Sprintf("CNAME: %s", strings.TrimSuffix(cname, "."))
-				}
+				continue
+			}
+			if cfg.Silent {
+				continue
+			}
 
-				fmt.Printf("%-15s %-25s | %s\n", ipStr, tag, source)
+			// Visual Output
+			tag := "[\033[32mPotential Origin\033[0m]"
+			if isCDN {
+				tag = fmt.Sprintf("[\033[31m%s CDN\033[0m]", val)
 			}
+			fmt.Printf("  └── %-15s %s\n", ipStr, tag)
 		}
 	}
 }
 
-// registerIP tracks IP frequency and source information
-func registerIP(ip, domain, source string) {
-	if _, exists := registry[ip]; !exists {
-		registry[ip] = &IPInfo{Source: source}
-	}
-	registry[ip].Count++
-	registry[ip].Domains = append(registry[ip].Domains, domain)
-}
-
-// resolveAndRegister resolves a domain and registers its IPs
-func resolveAndRegister(target, source string) {
-	if ips, ok := lookupLocalHosts(target); ok {
-		for _, ip := range ips {
-			registerIP(ip, target, source)
-		}
-		return
-	}
-	if offlineMode {
-		return
-	}
-
-	ips, err := net.LookupIP(target)
+// resolveAndRegister resolves a domain and registers its IPs, reporting whether it resolved
+func resolveAndRegister(target, source string) bool {
+	res, err := lookupHost(target, getRandomResolver())
 	if err != nil {
-		return
+		return false
 	}
-	for _, ip := range ips {
-		registerIP(ip.String(), target, source)
+	traceIfAliased(target, res)
+	trackCNAME(target, res, source)
+	if !res.Exists() {
+		return false
+	}
+	for _, ip := range res.IPs() {
+		assets.addAddress(target, ip, source)
 	}
+	jsonOut.host(assets.view(target, source), nil, getResolverName(res.Resolver), source)
+	return true
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEmitFoundWritesFilteredIPs(t *testing.T) {
+	assets = newAssetStore(64)
+	f, err := os.Create(filepath.Join(t.TempDir(), "found.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg := &scanConfig{
+		Domain:     "example.com",
+		FoundItems: &sync.Map{},
+		Files:      map[string]*os.File{"csv": f},
+		Silent:     true,
+		FilterCDN:  true,
+		Wildcards:  newWildcardCache("example.com", 0, true, nil),
+	}
+
+	// The CDN edge is already linked to the host, e.g. from a checkpoint
+	assets.addAddress("www.example.com", "104.16.0.1", "Wordlist")
+	if !emitFound(cfg, "www.example.com", []string{"104.16.0.1", "192.0.2.10"}, "local", "Wordlist") {
+		t.Fatal("host with an origin address was not emitted")
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if got := records[0][1]; got != "192.0.2.10" {
+		t.Errorf("written IPs = %q, want only the unfiltered 192.0.2.10", got)
+	}
+}
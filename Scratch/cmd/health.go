@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	healthWindow      = 100              // recent outcomes considered for quarantine
+	healthMinSamples  = 20               // outcomes needed before a resolver can be quarantined
+	healthFailRatio   = 0.5              // failure share of the window that triggers quarantine
+	quarantineBase    = 30 * time.Second // first quarantine; doubles on each repeat
+	quarantineMax     = 5 * time.Minute
+	defaultLatencyEst = 200 * time.Millisecond
+)
+
+// resolverStats is the running scorecard for one resolver
+type resolverStats struct {
+	Addr          string
+	Queries       int64
+	Answers       int64
+	Timeouts      int64
+	ServFails     int64
+	Refused       int64
+	Disagreements int64
+	Quarantines   int
+	latency       time.Duration // EWMA of answered queries
+	recent        []bool        // ring of recent outcomes, true = failure
+	recentPos     int
+	benchedUntil  time.Time
+}
+
+// resolverHealth tracks per-resolver statistics and drives weighted selection
+type resolverHealth struct {
+	mu    sync.Mutex
+	stats map[string]*resolverStats
+}
+
+var health = &resolverHealth{stats: make(map[string]*resolverStats)}
+
+// get returns the scorecard for addr, creating it on first use. Caller holds mu.
+func (h *resolverHealth) get(addr string) *resolverStats {
+	s, ok := h.stats[addr]
+	if !ok {
+		s = &resolverStats{Addr: addr, recent: make([]bool, 0, healthWindow)}
+		h.stats[addr] = s
+	}
+	return s
+}
+
+// observe records the outcome of one query sent to addr
+func (h *resolverHealth) observe(addr string, res *DNSResult, err error) {
+	if addr == "" || addr == "local" {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(addr)
+	s.Queries++
+	failed := false
+	switch {
+	case err != nil:
+		s.Timeouts++
+		failed = true
+	case res.Rcode == dns.RcodeServerFailure:
+		s.ServFails++
+		failed = true
+	case res.Rcode == dns.RcodeRefused:
+		s.Refused++
+		failed = true
+	default:
+		s.Answers++
+		if s.latency == 0 {
+			s.latency = res.RTT
+		} else {
+			s.latency = (s.latency*7 + res.RTT) / 8
+		}
+	}
+	h.push(s, failed)
+}
+
+// disagreed records that addr's answer was outvoted by its peers
+func (h *resolverHealth) disagreed(addr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(addr)
+	s.Disagreements++
+	h.push(s, true)
+}
+
+// push appends an outcome to the window and benches the resolver if it is failing. Caller holds mu.
+func (h *resolverHealth) push(s *resolverStats, failed bool) {
+	if len(s.recent) < healthWindow {
+		s.recent = append(s.recent, failed)
+	} else {
+		s.recent[s.recentPos] = failed
+		s.recentPos = (s.recentPos + 1) % healthWindow
+	}
+
+	if len(s.recent) < healthMinSamples || time.Now().Before(s.benchedUntil) {
+		return
+	}
+	fails := 0
+	for _, f := range s.recent {
+		if f {
+			fails++
+		}
+	}
+	if float64(fails)/float64(len(s.recent)) < healthFailRatio || h.lastStanding(s) {
+		return
+	}
+
+	penalty := quarantineBase << s.Quarantines
+	if penalty > quarantineMax || penalty <= 0 {
+		penalty = quarantineMax
+	}
+	s.Quarantines++
+	s.benchedUntil = time.Now().Add(penalty)
+	// Give it a clean slate when it comes back
+	s.recent = s.recent[:0]
+	s.recentPos = 0
+}
+
+// lastStanding reports whether s is the only resolver not already benched. Caller holds mu.
+func (h *resolverHealth) lastStanding(s *resolverStats) bool {
+	now := time.Now()
+	for addr, other := range h.stats {
+		if addr != s.Addr && !now.Before(other.benchedUntil) {
+			return false
+		}
+	}
+	return true
+}
+
+// score weighs reliability against speed; higher is better. Caller holds mu.
+func (s *resolverStats) score() float64 {
+	bad := s.Timeouts + s.ServFails + s.Refused + s.Disagreements
+	reliability := float64(s.Queries-bad+1) / float64(s.Queries+2)
+	if reliability < 0.01 {
+		reliability = 0.01
+	}
+	lat := s.latency
+	if lat <= 0 {
+		lat = defaultLatencyEst
+	}
+	if lat < time.Millisecond {
+		lat = time.Millisecond
+	}
+	return reliability * reliability * (1000 / float64(lat.Milliseconds()+1))
+}
+
+// pick chooses a resolver from candidates weighted by score, skipping benched
+// ones and anything in exclude. If every candidate is benched, the one that
+// comes back soonest is used.
+func (h *resolverHealth) pick(candidates []string, exclude ...string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	var pool []string
+	var weights []float64
+	var total float64
+	var fallback string
+	var fallbackUntil time.Time
+
+next:
+	for _, addr := range candidates {
+		for _, ex := range exclude {
+			if addr == ex {
+				continue next
+			}
+		}
+		s := h.get(addr)
+		if now.Before(s.benchedUntil) {
+			if fallback == "" || s.benchedUntil.Before(fallbackUntil) {
+				fallback, fallbackUntil = addr, s.benchedUntil
+			}
+			continue
+		}
+		w := s.score()
+		pool = append(pool, addr)
+		weights = append(weights, w)
+		total += w
+	}
+
+	if len(pool) == 0 {
+		return fallback
+	}
+	r := rand.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return pool[i]
+		}
+		r -= w
+	}
+	return pool[len(pool)-1]
+}
+
+// verifyAnswer cross-checks a positive answer with other resolvers. When a peer
+// says the name does not exist, a third resolver breaks the tie and the loser
+// is charged a disagreement. Returns false if the original answer was outvoted.
+// Each cross-check query spends a -qps token.
+func verifyAnswer(target string, res *DNSResult) bool {
+	if res.Resolver == "local" || len(resolverNames) < 2 {
+		return true
+	}
+
+	peer := getRandomResolver(res.Resolver)
+	if peer == "" {
+		return true
+	}
+	if queryLimiter != nil {
+		<-queryLimiter
+	}
+	peerRes, err := queryDNS(target, dns.TypeA, peer)
+	if err != nil || peerRes.Resolver != peer || peerRes.Exists() || peerRes.Rcode != dns.RcodeNameError {
+		// Timeouts prove nothing and differing IPs are normal for geo DNS
+		return true
+	}
+
+	judge := getRandomResolver(res.Resolver, peer)
+	if judge == "" {
+		return true
+	}
+	if queryLimiter != nil {
+		<-queryLimiter
+	}
+	judgeRes, err := queryDNS(target, dns.TypeA, judge)
+	if err != nil || judgeRes.Resolver != judge {
+		return true
+	}
+	if judgeRes.Exists() {
+		health.disagreed(peer)
+		return true
+	}
+	if judgeRes.Rcode == dns.RcodeNameError {
+		health.disagreed(res.Resolver)
+		return false
+	}
+	return true
+}
+
+// printResolverSummary renders how each resolver performed during the scan
+func printResolverSummary() {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	var rows []*resolverStats
+	for _, s := range health.stats {
+		if s.Queries > 0 || s.Disagreements > 0 {
+			rows = append(rows, s)
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].score() > rows[j].score() })
+
+	fmt.Printf("\n\033[1m\033[34m[*] RESOLVER PERFORMANCE:\033[0m\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  RESOLVER\tQUERIES\tAVG RTT\tTIMEOUT\tSERVFAIL\tREFUSED\tDISAGREE\tBENCHED\tSTATUS")
+	now := time.Now()
+	for _, s := range rows {
+		status := "\033[32mOK\033[0m"
+		if _, active := resolverNames[s.Addr]; !active {
+			status = "\033[31mDROPPED\033[0m"
+		} else if now.Before(s.benchedUntil) {
+			status = "\033[31mQUARANTINED\033[0m"
+		} else if s.Quarantines > 0 {
+			status = "\033[33mRECOVERED\033[0m"
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%s\t%d\t%d\t%d\t%d\t%dx\t%s\n",
+			getResolverName(s.Addr), s.Queries, s.latency.Round(time.Millisecond),
+			s.Timeouts, s.ServFails, s.Refused, s.Disagreements, s.Quarantines, status)
+	}
+	w.Flush()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"os"
 	"strings"
 )
@@ -42,6 +43,18 @@ func loadHostsFile(path string) (map[string][]string, error) {
 	return hosts, nil
 }
 
+// localAlias returns the CNAME target of a hosts-file entry ("" when it only has
+// addresses); ok is false when name isn't in the hosts map
+func localAlias(name string) (alias string, ok bool) {
+	values, ok := lookupLocalHosts(name)
+	for _, v := range values {
+		if net.ParseIP(v) == nil {
+			alias = strings.ToLower(strings.TrimSuffix(v, "."))
+		}
+	}
+	return alias, ok
+}
+
 func lookupLocalHosts(target string) ([]string, bool) {
 	if len(localHosts) == 0 {
 		return nil, false
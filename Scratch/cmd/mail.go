@@ -0,0 +1,444 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// smtpTimeout bounds the connect plus banner/EHLO exchange with one mail server
+var smtpTimeout = 8 * time.Second
+
+// smtpHelo is the name Scratch introduces itself with in EHLO
+const smtpHelo = "localhost"
+
+// mailProviders maps hostname suffixes seen in MX, DKIM and report records to
+// the hosted service behind them
+var mailProviders = []struct{ Suffix, Name string }{
+	{"google.com", "Google Workspace"},
+	{"googlemail.com", "Google Workspace"},
+	{"outlook.com", "Microsoft 365"},
+	{"onmicrosoft.com", "Microsoft 365"},
+	{"pphosted.com", "Proofpoint"},
+	{"ppe-hosted.com", "Proofpoint"},
+	{"mimecast.com", "Mimecast"},
+	{"messagelabs.com", "Broadcom Email Security"},
+	{"iphmx.com", "Cisco Secure Email"},
+	{"barracudanetworks.com", "Barracuda"},
+	{"trendmicro.com", "Trend Micro"},
+	{"zoho.com", "Zoho Mail"},
+	{"zoho.eu", "Zoho Mail"},
+	{"secureserver.net", "GoDaddy"},
+	{"yandex.net", "Yandex"},
+	{"protonmail.ch", "Proton Mail"},
+	{"icloud.com", "iCloud Mail"},
+	{"mailgun.org", "Mailgun"},
+	{"sendgrid.net", "SendGrid"},
+	{"amazonses.com", "Amazon SES"},
+	{"mcsv.net", "Mailchimp"},
+	{"mandrillapp.com", "Mandrill"},
+	{"mtasv.net", "Postmark"},
+	{"postmarkapp.com", "Postmark"},
+	{"agari.com", "Agari"},
+	{"dmarcian.com", "dmarcian"},
+	{"valimail.com", "Valimail"},
+	{"ondmarc.com", "Red Sift OnDMARC"},
+	{"dmarcanalyzer.com", "DMARC Analyzer"},
+	{"easydmarc.us", "EasyDMARC"},
+	{"easydmarc.com", "EasyDMARC"},
+	{"uriports.com", "URIports"},
+}
+
+// dkimSelectors are probed under _domainkey; the value names the service the
+// selector usually belongs to (empty for generic selectors)
+var dkimSelectors = map[string]string{
+	"google":    "Google Workspace",
+	"selector1": "Microsoft 365",
+	"selector2": "Microsoft 365",
+	"k1":        "Mailchimp",
+	"k2":        "Mailchimp",
+	"s1":        "SendGrid",
+	"s2":        "SendGrid",
+	"mandrill":  "Mandrill",
+	"pm":        "Postmark",
+	"zoho":      "Zoho Mail",
+	"amazonses": "Amazon SES",
+	"default":   "",
+	"dkim":      "",
+	"mail":      "",
+	"smtp":      "",
+	"selector":  "",
+}
+
+// sesInbound matches Amazon SES receiving endpoints. The rest of amazonaws.com
+// is EC2 and friends, where an MX is as self-hosted as anywhere else.
+var sesInbound = regexp.MustCompile(`^inbound-smtp\.[a-z0-9-]+\.amazonaws\.com$`)
+
+// mailProvider names the hosted service a hostname belongs to, if known
+func mailProvider(host string) string {
+	if sesInbound.MatchString(host) {
+		return "Amazon SES"
+	}
+	for _, p := range mailProviders {
+		if inZone(host, p.Suffix) {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// mailServer is one MX host with what its SMTP service revealed
+type mailServer struct {
+	Host     string
+	IPs      []string
+	Provider string
+	Banner   string
+	EHLO     string
+	Err      error
+}
+
+// dkimKey is a selector that published a key, with the service it points to
+type dkimKey struct {
+	Selector string
+	Provider string
+	Target   string // CNAME target when the key is delegated
+}
+
+// mailReport collects the mail-related records of a domain
+type mailReport struct {
+	Servers   []*mailServer
+	DMARC     map[string]string // tag -> value
+	Reporters []string          // domains receiving rua/ruf reports
+	DKIM      []dkimKey
+	BIMI      map[string]string
+}
+
+// fetchTXT returns the TXT strings at name, plus the CNAME chain the resolver followed
+func fetchTXT(name string) ([]string, []string) {
+	res, err := queryDNS(name, dns.TypeTXT, getRandomResolver())
+	if err != nil || !res.Exists() {
+		return nil, nil
+	}
+	var txt []string
+	for _, rec := range res.Answers {
+		if rec.Type == "TXT" {
+			txt = append(txt, strings.TrimSpace(rec.Value))
+		}
+	}
+	return txt, res.CNAMEChain()
+}
+
+// parseTags splits "v=DMARC1; p=reject; rua=..." style records into a tag map
+func parseTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok {
+			tags[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return tags
+}
+
+// findTagged returns the first record carrying the given version tag (v=DMARC1, v=BIMI1)
+func findTagged(records []string, version string) map[string]string {
+	for _, r := range records {
+		if tags := parseTags(r); strings.EqualFold(tags["v"], version) {
+			return tags
+		}
+	}
+	return nil
+}
+
+// reportDomains extracts the domains of mailto: URIs in DMARC rua/ruf tags
+func reportDomains(tags map[string]string) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, key := range []string{"rua", "ruf"} {
+		for _, uri := range strings.Split(tags[key], ",") {
+			addr := strings.TrimPrefix(strings.TrimSpace(uri), "mailto:")
+			// A size limit may follow the address ("dmarc@example.com!10m")
+			addr, _, _ = strings.Cut(addr, "!")
+			if _, host, ok := strings.Cut(addr, "@"); ok && host != "" {
+				host = strings.ToLower(host)
+				if !seen[host] {
+					seen[host] = true
+					domains = append(domains, host)
+				}
+			}
+		}
+	}
+	return domains
+}
+
+// probeSMTP connects to ip:port, reads the greeting and sends EHLO. It returns the
+// banner text and the hostname the server gave in its EHLO reply.
+func probeSMTP(ip, port string) (string, string, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, port), smtpTimeout)
+	if err != nil {
+		return "", "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	tp := textproto.NewConn(conn)
+	_, banner, err := tp.ReadResponse(220)
+	if err != nil {
+		return banner, "", err
+	}
+	banner, _, _ = strings.Cut(banner, "\n")
+
+	if err := tp.PrintfLine("EHLO %s", smtpHelo); err != nil {
+		return banner, "", err
+	}
+	_, reply, err := tp.ReadResponse(250)
+	if err != nil {
+		return banner, "", err
+	}
+	ehlo := ""
+	if fields := strings.Fields(reply); len(fields) > 0 {
+		ehlo = strings.ToLower(fields[0])
+	}
+	_ = tp.PrintfLine("QUIT")
+	return banner, ehlo, nil
+}
+
+// bannerHost returns the hostname a 220 greeting announces (its first word)
+func bannerHost(banner string) string {
+	if fields := strings.Fields(banner); len(fields) > 0 && strings.Contains(fields[0], ".") {
+		return strings.ToLower(strings.TrimSuffix(fields[0], "."))
+	}
+	return ""
+}
+
+// mailServerInScope reports whether srv's name, every address it resolved to
+// and port are in scope for a banner grab
+func mailServerInScope(srv *mailServer, port int) bool {
+	if !inScope.AllowHost(srv.Host, "SMTP banner") {
+		return false
+	}
+	for _, ip := range srv.IPs {
+		if !inScope.AllowIP(ip, "SMTP banner") {
+			return false
+		}
+	}
+	return inScope.AllowPort(port, "SMTP banner")
+}
+
+// collectMail resolves the MX set, probes each server's SMTP port and reads the
+// DMARC, DKIM and BIMI records of domain
+func collectMail(domain, smtpPort string, selectors []string) *mailReport {
+	report := &mailReport{}
+
+	for _, host := range lookupMXHosts(domain) {
+		srv := &mailServer{Host: host, Provider: mailProvider(host)}
+		if res, err := lookupHost(host, getRandomResolver()); err == nil && res.Exists() {
+			srv.IPs = res.IPs()
+		}
+		report.Servers = append(report.Servers, srv)
+	}
+
+	var wg sync.WaitGroup
+	// -smtp-port is validated at startup; empty means don't connect
+	port, err := strconv.Atoi(smtpPort)
+	for _, srv := range report.Servers {
+		if len(srv.IPs) == 0 || err != nil {
+			continue
+		}
+		if !mailServerInScope(srv, port) {
+			continue
+		}
+		wg.Add(1)
+		go func(srv *mailServer) {
+			defer wg.Done()
+			srv.Banner, srv.EHLO, srv.Err = probeSMTP(srv.IPs[0], smtpPort)
+		}(srv)
+	}
+	wg.Wait()
+
+	if records, _ := fetchTXT("_dmarc." + domain); records != nil {
+		if report.DMARC = findTagged(records, "DMARC1"); report.DMARC != nil {
+			report.Reporters = reportDomains(report.DMARC)
+		}
+	}
+
+	for _, sel := range selectors {
+		records, chain := fetchTXT(sel + "._domainkey." + domain)
+		if records == nil && len(chain) == 0 {
+			continue
+		}
+		key := dkimKey{Selector: sel, Provider: dkimSelectors[sel]}
+		if len(chain) > 0 {
+			key.Target = chain[len(chain)-1]
+			if p := mailProvider(key.Target); p != "" {
+				key.Provider = p
+			}
+		}
+		report.DKIM = append(report.DKIM, key)
+	}
+
+	if records, _ := fetchTXT("default._bimi." + domain); records != nil {
+		report.BIMI = findTagged(records, "BIMI1")
+	}
+	return report
+}
+
+// dkimSelectorList returns the built-in selectors plus any extras, sorted
+func dkimSelectorList(extra string) []string {
+	seen := make(map[string]bool)
+	var selectors []string
+	for sel := range dkimSelectors {
+		seen[sel] = true
+		selectors = append(selectors, sel)
+	}
+	for _, sel := range splitList(extra) {
+		if !seen[sel] {
+			seen[sel] = true
+			selectors = append(selectors, sel)
+		}
+	}
+	sort.Strings(selectors)
+	return selectors
+}
+
+// urlHost returns the hostname of a BIMI logo/certificate URL
+func urlHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// analyzeMail reports the domain's mail setup and registers self-hosted mail
+// servers as origin candidates. Provider-hosted MX addresses are not registered.
+func analyzeMail(domain, smtpPort string, selectors []string, ipOnly, silent bool) {
+	report := collectMail(domain, smtpPort, selectors)
+	registered := 0
+
+	if len(report.Servers) == 0 && !silent {
+		fmt.Println("[-] No MX records")
+	}
+	for _, srv := range report.Servers {
+		tag := "\033[32m[SELF-HOSTED]\033[0m"
+		if srv.Provider != "" {
+			tag = fmt.Sprintf("\033[36m[%s]\033[0m", srv.Provider)
+		}
+		if !silent {
+			fmt.Printf("\033[32m[+] MX:\033[0m %-30s %s %s\n", srv.Host, strings.Join(srv.IPs, ", "), tag)
+			switch {
+			case srv.Err != nil:
+				fmt.Printf("    SMTP: \033[33m%v\033[0m\n", srv.Err)
+			case srv.Banner != "":
+				fmt.Printf("    SMTP: %s | EHLO: %s\n", srv.Banner, srv.EHLO)
+			}
+		}
+
+		// Names a server gives itself often differ from its MX name and leak internal hosts
+		names := []string{bannerHost(srv.Banner)}
+		if srv.EHLO != names[0] {
+			names = append(names, srv.EHLO)
+		}
+		for _, name := range names {
+			if name == "" || name == srv.Host || !inZone(name, domain) {
+				continue
+			}
+			if resolveAndRegister(name, "SMTP Banner") && !silent {
+				fmt.Printf("    \033[1m\033[32m[NEW]\033[0m %s (from SMTP banner)\n", name)
+			}
+		}
+
+		if srv.Provider != "" {
+			continue
+		}
+		for _, ip := range srv.IPs {
+			if matched, _, _, _ := cdnClient.Check(parseAddr(ip)); matched {
+				continue
+			}
+			if !inScope.AllowIP(ip, "MX") {
+				continue
+			}
+			assets.addAddress(srv.Host, ip, "MX")
+			registered++
+			if ipOnly {
+				fmt.Println(ip)
+			}
+		}
+	}
+
+	// In-scope report and logo hosts are names worth resolving like any other
+	for _, d := range report.Reporters {
+		if inZone(d, domain) {
+			resolveAndRegister(d, "DMARC")
+		}
+	}
+	bimiHosts := make(map[string]bool)
+	for _, key := range []string{"l", "a"} {
+		if host := urlHost(report.BIMI[key]); host != "" && inZone(host, domain) && !bimiHosts[host] {
+			bimiHosts[host] = true
+			resolveAndRegister(host, "BIMI")
+		}
+	}
+
+	if silent {
+		return
+	}
+	if report.DMARC != nil {
+		policy := report.DMARC["p"]
+		if sp := report.DMARC["sp"]; sp != "" {
+			policy += ", sp=" + sp
+		}
+		fmt.Printf("\033[32m[+] DMARC:\033[0m p=%s\n", policy)
+		for _, d := range report.Reporters {
+			note := "external"
+			if inZone(d, domain) {
+				note = "in scope"
+			}
+			if p := mailProvider(d); p != "" {
+				note = p
+			}
+			fmt.Printf("    reports -> %s (%s)\n", d, note)
+		}
+	} else {
+		fmt.Println("[-] No DMARC record")
+	}
+
+	if len(report.DKIM) > 0 {
+		var found []string
+		for _, key := range report.DKIM {
+			desc := key.Selector
+			if key.Provider != "" {
+				desc += " (" + key.Provider + ")"
+			}
+			if key.Target != "" {
+				desc += " -> " + key.Target
+			}
+			found = append(found, desc)
+		}
+		fmt.Printf("\033[32m[+] DKIM:\033[0m %s\n", strings.Join(found, ", "))
+	}
+
+	if report.BIMI != nil {
+		for _, key := range []string{"l", "a"} {
+			host := urlHost(report.BIMI[key])
+			if host == "" {
+				continue
+			}
+			label := map[string]string{"l": "logo", "a": "certificate"}[key]
+			fmt.Printf("\033[32m[+] BIMI:\033[0m %s hosted on %s\n", label, host)
+		}
+	}
+
+	if registered > 0 {
+		fmt.Printf("[+] Registered %d self-hosted mail address(es) as origin candidates\n", registered)
+	}
+}
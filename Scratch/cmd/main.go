@@ -1,16 +1,17 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"net"
-	"net/http"
 	"os"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
+
+	"scope"
 )
 
 // getMapKeys converts map keys to slice for display
@@ -22,71 +23,19 @@ func getMapKeys(m map[string]bool) []string {
 	return keys
 }
 
-// fetchWordlist downloads wordlist from URL if needed, otherwise reads from file
-func fetchWordlist(path string) ([]string, error) {
-	// Check if it's a URL
-	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
-		fmt.Printf("[*] Fetching wordlist from: %s\n", path)
-
-		client := &http.Client{Timeout: 30 * time.Second}
-		resp, err := client.Get(path)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download wordlist: %v", err)
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != 200 {
-			return nil, fmt.Errorf("wordlist download failed with status: %d", resp.StatusCode)
-		}
-
-		var lines []string
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			if line != "" && !strings.HasPrefix(line, "#") {
-				lines = append(lines, line)
-			}
-		}
-
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("error reading wordlist: %v", err)
-		}
-
-		fmt.Printf("[+] Downloaded %d words from online wordlist\n", len(lines))
-		return lines, nil
-	}
-
-	// Otherwise, read from local file
-	file, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open wordlist file: %v", err)
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			lines = append(lines, line)
-		}
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading wordlist: %v", err)
-	}
-
-	return lines, nil
-}
-
 func main() {
 	// 1. FLAGS
-	domain := flag.String("d", "", "Target domain")
-	wordlist := flag.String("w", "subs.txt", "Path to wordlist or URL")
+	target := flag.String("d", "", "Target domain")
+	targetList := flag.String("dL", "", "File of apex domains to scan one after another (one per line)")
+	combined := flag.String("combined", "", "Write every domain's findings to <name>_recon.* keyed by apex instead of per-domain files")
+	var wordlistSources, recurseSources listFlag
+	flag.Var(&wordlistSources, "w", "Wordlist file, directory, URL or - for stdin; repeatable, gzip/zstd accepted (default: subs.txt)")
 	csvOut := flag.Bool("csv", false, "Output in CSV")
 	txtOut := flag.Bool("txt", false, "Output in TXT")
 	xmlOut := flag.Bool("xml", false, "Output in XML")
 	grepOut := flag.Bool("grep", false, "Output in Grepable format")
+	jsonFile := flag.Bool("json", false, "Write findings as JSON Lines to <domain>_recon.jsonl")
+	jsonlOut := flag.Bool("jsonl", false, "Stream findings as JSON Lines to stdout (suppresses other console output)")
 	urlOnly := flag.Bool("url", false, "Output raw URLs only")
 	ipOnly := flag.Bool("ip", false, "Output raw IPs only")
 	threads := flag.Int("t", 10, "Number of workers")
@@ -94,309 +43,436 @@ func main() {
 	burst := flag.Int("burst", 2, "Rate limiter burst size")
 	delay := flag.Int("delay", 0, "Base delay (ms)")
 	jitter := flag.Int("jitter", 0, "Jitter (ms)")
-	filterCDN := flag.Bool("filter", false, "Tag or hide CDN/Cloud IPs")
+	filterCDN := flag.Bool("filter", false, "Tag or hide CDN/Cloud IPs and, in infrastructure analysis, addresses shared by more than 3 hosts")
 	hostsFile := flag.String("hosts", "", "Local hosts map for offline testing (format: host ip1 [ip2...])")
 	offline := flag.Bool("offline", false, "Disable external DNS/CT/SPF lookups (useful with -hosts)")
+	sockets := flag.Int("sockets", 4, "UDP sockets shared by the resolver engine")
+	timeoutMs := flag.Int("timeout", 2000, "Per-query DNS timeout (ms)")
+	retries := flag.Int("retries", 2, "Retries per query before giving up")
+	resolverFile := flag.String("r", "", "Resolver list (format: ip[:port]|tcp://ip|tls://host|https://url [name])")
+	insecure := flag.Bool("insecure", false, "Skip TLS verification for DoT/DoH resolvers")
+	validate := flag.Bool("validate", true, "Probe resolvers before scanning and drop dead or lying ones")
+	probe := flag.String("probe", "one.one.one.one=1.1.1.1", "Known-answer probe for resolver validation (name[=ip])")
+	probeNX := flag.String("probe-nx", "example.com", "Zone used for the NXDOMAIN probe (random label is prepended)")
+	recursive := flag.Bool("recursive", false, "Brute force below every discovered subdomain")
+	maxDepth := flag.Int("depth", 2, "Maximum labels below the domain to brute force with -recursive")
+	flag.Var(&recurseSources, "rw", "Smaller wordlist for recursive levels, same forms as -w (default: -w)")
+	axfr := flag.Bool("axfr", false, "Attempt AXFR/IXFR against the domain's nameservers")
+	axfrPort := flag.String("axfr-port", "53", "TCP port used for zone transfer attempts")
+	dnssecWalk := flag.Bool("dnssec", false, "Walk NSEC chains and crack NSEC3 hashes of DNSSEC-signed zones")
+	walkMax := flag.Int("walk-max", 5000, "Maximum queries spent walking NSEC/NSEC3 records")
+	permute := flag.Bool("permute", false, "Resolve alterations of discovered names (dev-/-staging, number bumps, word insertion)")
+	permMax := flag.Int("perm-max", 5000, "Maximum permutations to generate")
+	permWords := flag.Int("perm-words", 25, "Wordlist entries used for word insertion during permutation")
+	wildcardSamples := flag.Int("wc-samples", 3, "Random labels resolved per zone level to fingerprint wildcards")
+	aaaa := flag.Bool("aaaa", true, "Query AAAA records alongside A")
+	v6Prefix := flag.Int("v6-prefix", 64, "Prefix length used to group IPv6 addresses in infrastructure analysis (e.g. 48, 56, 64)")
+	ptrSweep := flag.Bool("ptr", false, "Sweep PTR records across unique-origin subnets")
+	ptrPrefix := flag.Int("ptr-prefix", 24, "IPv4 prefix length swept around each unique-origin IP (16-32)")
+	ptrKeywordList := flag.String("ptr-keywords", "", "Comma-separated keywords that make out-of-domain PTR names relevant (default: first domain label)")
+	spfLookups := flag.Int("spf-lookups", 10, "Maximum DNS-querying SPF terms (include, a, mx, redirect, ...) to follow")
+	mailCheck := flag.Bool("mail", false, "Analyze MX, DMARC, DKIM and BIMI records and grab SMTP banners from mail servers")
+	smtpPort := flag.String("smtp-port", "25", "Port used to grab SMTP banners from MX hosts (empty = don't connect)")
+	dkimList := flag.String("dkim-selectors", "", "Comma-separated DKIM selectors to probe on top of the built-in list")
+	takeover := flag.Bool("takeover", false, "Check CNAMEs for dangling targets and unclaimed third-party services")
+	fingerprintFile := flag.String("fingerprints", "", "Takeover fingerprint file (JSON, default: built-in list)")
+	takeoverHTTP := flag.String("takeover-http", "http,https", "Endpoints fetched for takeover fingerprints (scheme[:port], comma-separated)")
+	sourceList := flag.String("sources", "all", "Comma-separated passive sources to run (all, crtsh, ...)")
+	excludeSources := flag.String("exclude-sources", "", "Comma-separated passive sources to skip")
+	sourceTimeout := flag.Duration("source-timeout", 30*time.Second, "Default timeout for each passive source")
+	sourceTimeoutList := flag.String("source-timeouts", "", "Per-source timeout overrides (e.g. crtsh=60s)")
+	crtshURL := flag.String("crtsh-url", "https://crt.sh/", "Base URL of the crt.sh JSON API")
+	certsPath := flag.String("certs", "", "Directory or file of certificates (PEM/DER) or CT JSON exports to ingest")
+	resume := flag.Bool("resume", false, "Resume an interrupted scan from its checkpoint")
+	checkpointFile := flag.String("checkpoint", "", "Checkpoint file (default: <domain>_recon.checkpoint)")
+	checkpointInterval := flag.Duration("checkpoint-interval", 30*time.Second, "How often progress is saved to the checkpoint, which every run writes and removes on completion (0 = only between phases and on interrupt)")
+	scopeFile := flag.String("scope", "", "Engagement scope file; out-of-scope discoveries and probes are refused and logged to scratch_scope.log")
+	verify := flag.Bool("verify", true, "Confirm found hosts with a second resolver and penalize resolvers that disagree")
 	flag.Parse()
 
-	if *domain == "" {
-		fmt.Println("[!] Usage: ./scratch -d <domain> [-url] [-ip]")
+	var domains []string
+	if *target != "" {
+		domains = append(domains, strings.ToLower(strings.Trim(*target, ".")))
+	}
+	if *targetList != "" {
+		listed, err := loadDomains(*targetList)
+		if err != nil {
+			fmt.Printf("[!] Domain list error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, d := range listed {
+			if !slices.Contains(domains, d) {
+				domains = append(domains, d)
+			}
+		}
+	}
+	if len(domains) == 0 {
+		fmt.Println("[!] Usage: ./scratch -d <domain> | -dL <domains.txt> [-url] [-ip]")
+		os.Exit(1)
+	}
+	if *checkpointFile != "" && len(domains) > 1 {
+		fmt.Println("[!] -checkpoint needs a single domain; -dL scans use <domain>_recon.checkpoint")
+		os.Exit(1)
+	}
+	if len(wordlistSources) == 0 {
+		wordlistSources = listFlag{"subs.txt"}
+	}
+	// Checkpoints skip words by position, which only works if the input is the same
+	if *resume && slices.Contains(wordlistSources, "-") {
+		fmt.Println("[!] -resume can't be used with -w -: stdin may not replay the same words")
+		os.Exit(1)
+	}
+	if *v6Prefix < 1 || *v6Prefix > 128 {
+		fmt.Println("[!] -v6-prefix must be between 1 and 128")
+		os.Exit(1)
+	}
+	if *ptrPrefix < 16 || *ptrPrefix > 32 {
+		fmt.Println("[!] -ptr-prefix must be between 16 and 32")
+		os.Exit(1)
+	}
+	if *smtpPort != "" {
+		if p, err := strconv.Atoi(*smtpPort); err != nil || p < 1 || p > 65535 {
+			fmt.Println("[!] -smtp-port must be a port between 1 and 65535 (or empty to skip banners)")
+			os.Exit(1)
+		}
+	}
+	configureSources(sourceOptions{CrtshURL: *crtshURL, CertsPath: *certsPath})
+	sources, err := selectSources(*sourceList, *excludeSources)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(1)
+	}
+	sourceTimeouts, err := parseSourceTimeouts(*sourceTimeoutList)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
+		os.Exit(1)
+	}
+	fingerprints, err := loadFingerprints(*fingerprintFile)
+	if err != nil {
+		fmt.Printf("[!] %v\n", err)
 		os.Exit(1)
 	}
 
 	// 2. INITIALIZATION
-	foundItems := sync.Map{}
-	var processedCount int64
-	silent := *urlOnly || *ipOnly
+	silent := *urlOnly || *ipOnly || *jsonlOut
+	if slices.Contains(wordlistSources, "-") && !silent {
+		fmt.Println("[*] Wordlist read from stdin: this scan can't be resumed with -resume")
+	}
 	offlineMode = *offline
-
-	if *hostsFile != "" {
-		hosts, err := loadHostsFile(*hostsFile)
+	dnsTimeout = time.Duration(*timeoutMs) * time.Millisecond
+	verifyPositives = *verify
+	resolveAAAA = *aaaa
+	tlsInsecure = *insecure
+	configureTransports()
+	defer streamConns.closeAll()
+
+	if *resolverFile != "" {
+		resolvers, err := loadResolversFile(*resolverFile)
 		if err != nil {
-			fmt.Printf("[!] Hosts file error: %v\n", err)
+			fmt.Printf("[!] Resolver file error: %v\n", err)
 			os.Exit(1)
 		}
-		localHosts = hosts
+		resolverNames = resolvers
 		if !silent {
-			fmt.Printf("[*] Loaded %d host entries from %s\n", len(localHosts), *hostsFile)
+			fmt.Printf("[*] Loaded %d resolvers from %s\n", len(resolverNames), *resolverFile)
 		}
 	}
 
-	// 3. WILDCARD DETECTION (Phase 1)
-	wildcardIPs := make(map[string]bool)
 	if !offlineMode {
-		if !silent {
-			fmt.Println("[*] Detecting wildcard responses...")
-		}
-
-		// Query a random string that definitely shouldn't exist
-		wildcardDomain := fmt.Sprintf("check-wildcard-random-999.%s", *domain)
-		res, _ := net.LookupHost(wildcardDomain)
-		for _, ip := range res {
-			wildcardIPs[ip] = true
+		engine, err := newMassResolver(*sockets, dnsTimeout, *retries)
+		if err != nil {
+			fmt.Printf("[!] Resolver engine error: %v\n", err)
+			os.Exit(1)
 		}
+		dnsEngine = engine
+		defer engine.Close()
 
-		if len(wildcardIPs) > 0 && !silent {
-			fmt.Printf("[+] Detected %d wildcard IP(s): %v\n", len(wildcardIPs), getMapKeys(wildcardIPs))
+		if *validate {
+			if !silent {
+				fmt.Printf("[*] Validating %d resolvers...\n", len(resolverNames))
+			}
+			valid := validateResolvers(resolverNames, parseProbe(*probe), *probeNX, silent)
+			if len(valid) == 0 {
+				fmt.Println("[!] No resolvers passed validation")
+				os.Exit(1)
+			}
+			resolverNames = valid
 		}
-	} else if !silent {
-		fmt.Println("[*] Offline mode enabled. Skipping wildcard detection.")
 	}
 
-	// 4. START WORKERS
-	files := make(map[string]*os.File)
-	if *csvOut {
-		files["csv"] = createOutput(*domain, "csv")
-	}
-	if *txtOut {
-		files["txt"] = createOutput(*domain, "txt")
-	}
-	if *xmlOut {
-		files["xml"] = createOutput(*domain, "xml")
-	}
-	if *grepOut {
-		files["grep"] = createOutput(*domain, "grep")
-	}
-
-	defer func() {
-		for ext, f := range files {
-			if ext == "xml" {
-				fmt.Fprintln(f, "</subdomains>")
+	if *scopeFile != "" {
+		rules, err := scope.Load(*scopeFile, func(msg string) {
+			logScope(msg)
+			if !silent {
+				fmt.Printf("\r\033[K\033[33m[-] %s\033[0m\n", msg)
 			}
-			f.Close()
+		})
+		if err != nil {
+			fmt.Printf("[!] Scope file error: %v\n", err)
+			os.Exit(1)
 		}
-	}()
-
-	// 5. START WORKERS
-	jobs := make(chan string)
-	var wg sync.WaitGroup
-
-	limiter := newTokenBucket(*qps, *burst)
+		inScope = rules
+	}
 
-	for i := 0; i < *threads; i++ {
-		wg.Add(1)
-		go scratchWorker(*domain, jobs, &wg, *delay, *jitter, limiter, &foundItems, &processedCount, files, *urlOnly, *ipOnly, silent, *filterCDN, wildcardIPs)
+	if *hostsFile != "" {
+		hosts, err := loadHostsFile(*hostsFile)
+		if err != nil {
+			fmt.Printf("[!] Hosts file error: %v\n", err)
+			os.Exit(1)
+		}
+		localHosts = hosts
+		if !silent {
+			fmt.Printf("[*] Loaded %d host entries from %s\n", len(localHosts), *hostsFile)
+		}
 	}
 
-	// 4. INGESTION (The critical part)
-	words, err := fetchWordlist(*wordlist)
+	// 3. INGESTION
+	// Words are streamed from their sources on every pass, never held in memory
+	allWords, err := newWordlist(wordlistSources, "")
 	if err != nil {
 		fmt.Printf("[!] Wordlist Error: %v\n", err)
-		close(jobs) // Close it so workers don't hang if file fails
 		return
 	}
-
-	for _, line := range words {
-		jobs <- line
-	}
-
-	// 5. THE SIGNAL & WAIT
-	close(jobs) // Tell workers no more data is coming
-	wg.Wait()   // Wait for them to finish current tasks
-
-	if !silent {
-		fmt.Print("\r\033[K")
-		fmt.Println("[*] Scan Complete. All workers have exited.")
-	}
-
-	// 6. SPF/TXT RECORD ANALYSIS FOR ORIGIN IP LEAKS
-	if !offlineMode {
-		if !silent {
-			fmt.Println("[*] Checking SPF/TXT records for origin IP leaks...")
+	defer allWords.close()
+	var recurseWords *wordlist
+	if len(recurseSources) > 0 {
+		if recurseWords, err = newWordlist(recurseSources, ""); err != nil {
+			fmt.Printf("[!] Recursion Wordlist Error: %v\n", err)
+			return
 		}
-		checkSPFLeaks(*domain, *ipOnly, silent)
-	} else if !silent {
-		fmt.Println("[*] Offline mode enabled. Skipping SPF/TXT checks.")
+		defer recurseWords.close()
 	}
 
-	// 7. CNAME CHASER LOGIC
-	if !silent {
-		fmt.Printf("\n\033[1m\033[34m[*] CNAME CHASER ANALYSIS:\033[0m %s\n", *domain)
-		fmt.Println(strings.Repeat("━", 40))
-	}
-	commonSubs := []string{"", "www", "dev", "api", "origin", "mail", "internal", "staging"}
-	for _, s := range commonSubs {
-		target := *domain
-		if s != "" {
-			target = s + "." + *domain
+	// Domains are scanned one after another and share the resolver pool,
+	// resolver health and the query rate limit; everything else is per domain
+	limiter := newTokenBucket(*qps, *burst)
+	queryLimiter = limiter
+	formats := map[string]bool{"csv": *csvOut, "txt": *txtOut, "xml": *xmlOut, "grep": *grepOut, "jsonl": *jsonFile}
+	var sharedFiles map[string]*os.File
+	if *combined != "" {
+		sharedFiles = openOutputs(*combined, formats, *resume, true)
+		defer closeOutputs(sharedFiles)
+	}
+
+	opts := &scanOptions{
+		MultiDomain:        len(domains) > 1,
+		Resume:             *resume,
+		CheckpointFile:     *checkpointFile,
+		CheckpointInterval: *checkpointInterval,
+		WordlistSources:    wordlistSources.String(),
+		Words:              allWords,
+		RecurseWords:       recurseWords,
+		Limiter:            limiter,
+		V6Prefix:           *v6Prefix,
+		WildcardSamples:    *wildcardSamples,
+		Threads:            *threads,
+		Delay:              *delay,
+		Jitter:             *jitter,
+		Silent:             silent,
+		URLOnly:            *urlOnly,
+		IPOnly:             *ipOnly,
+		JSONLOut:           *jsonlOut,
+		FilterCDN:          *filterCDN,
+		Formats:            formats,
+		Combined:           *combined,
+		SharedFiles:        sharedFiles,
+		AXFR:               *axfr,
+		AXFRPort:           *axfrPort,
+		DNSSEC:             *dnssecWalk,
+		WalkMax:            *walkMax,
+		Recursive:          *recursive,
+		MaxDepth:           *maxDepth,
+		SPFLookups:         *spfLookups,
+		Mail:               *mailCheck,
+		SMTPPort:           *smtpPort,
+		DKIMSelectors:      dkimSelectorList(*dkimList),
+		Sources:            sources,
+		SourceTimeout:      *sourceTimeout,
+		SourceTimeouts:     sourceTimeouts,
+		Permute:            *permute,
+		PermMax:            *permMax,
+		PermWords:          *permWords,
+		Takeover:           *takeover,
+		Fingerprints:       fingerprints,
+		TakeoverHTTP:       splitList(*takeoverHTTP),
+		PTR:                *ptrSweep,
+		PTRPrefix:          *ptrPrefix,
+		PTRKeywordList:     *ptrKeywordList,
+	}
+
+	// 4. SCAN EVERY DOMAIN
+	var checkpoints []*checkpoint
+	for i, domain := range domains {
+		if len(domains) > 1 && !silent {
+			fmt.Printf("\n\033[1m\033[35m[*] TARGET %d/%d:\033[0m %s\n", i+1, len(domains), domain)
 		}
-		resolveAndRegister(target, "DNS/CNAME")
-	}
-
-	// 8. CERTIFICATE TRANSPARENCY SUBDOMAIN DISCOVERY
-	if !silent {
-		fmt.Printf("\n\033[1m\033[34m[*] CERTIFICATE TRANSPARENCY DISCOVERY:\033[0m %s\n", *domain)
-		fmt.Println(strings.Repeat("━", 40))
-	}
-	if !offlineMode {
-		ctSubs := fetchCTSubdomains(*domain)
-		if len(ctSubs) > 0 {
-			if !silent {
-				fmt.Printf("[+] Found %d subdomains from CT logs\n", len(ctSubs))
-			}
-			for _, s := range ctSubs {
-				resolveAndRegister(s, "CT Log")
-			}
-		} else if !silent {
-			fmt.Println("[-] No CT subdomains found")
+		if ckpt := scanDomain(domain, opts); ckpt != nil {
+			checkpoints = append(checkpoints, ckpt)
 		}
-	} else if !silent {
-		fmt.Println("[*] Offline mode enabled. Skipping CT discovery.")
 	}
 
-	// 9. INFRASTRUCTURE FINGERPRINTING (Subnet-Based Anomaly Detection)
+	// 5. RESOLVER SCORECARD
 	if !silent {
-		fmt.Printf("\n\033[1m\033[34m[!] INFRASTRUCTURE ANALYSIS FOR: %s\033[0m\n", *domain)
-		fmt.Println(strings.Repeat("━", 60))
+		printResolverSummary()
 	}
-
-	// Build IP registry from global registry
-	ipRegistry := make(map[string][]string)
-	for ip, info := range registry {
-		ipRegistry[ip] = info.Domains
+	for _, ckpt := range checkpoints {
+		ckpt.remove()
 	}
+}
 
-	// Group IPs by /24 subnet
-	subnets := make(map[string]*SubnetGroup)
-	for ip, domains := range ipRegistry {
-		// Calculate the /24 subnet (e.g., 185.88.181.0)
-		octets := strings.Split(ip, ".")
-		if len(octets) != 4 {
-			continue
-		}
-		cidr := fmt.Sprintf("%s.%s.%s.0/24", octets[0], octets[1], octets[2])
+// IPDetail tracks IP and associated domains
+type IPDetail struct {
+	IP      string
+	Domains []string
+}
 
-		if _, exists := subnets[cidr]; !exists {
-			subnets[cidr] = &SubnetGroup{IPs: make(map[string]bool)}
-		}
-		subnets[cidr].IPs[ip] = true
-		subnets[cidr].Hosts += len(domains)
-	}
+// SubnetGroup groups IPs by /24 subnet, or by a configurable prefix for IPv6
+type SubnetGroup struct {
+	IPs   map[string]bool
+	Hosts int
+}
 
-	// Output subnet analysis
-	for cidr, group := range subnets {
+// subnetReport is one subnet of the infrastructure analysis
+type subnetReport struct {
+	CIDR   string
+	IPs    []string
+	CDN    string // provider, when the subnet belongs to a CDN
+	Shared bool   // more than 10 host associations: a cluster, not a single server
+}
+
+// analyzeSubnets classifies every subnet in the asset store, sorted by CIDR.
+// With filterCDN, CDN subnets and addresses shared by many hosts are left out.
+func analyzeSubnets(filterCDN bool) []subnetReport {
+	var reports []subnetReport
+	for cidr, group := range assets.subnetGroups() {
 		// Check the first IP in the subnet for CDN status
 		firstIP := ""
 		for k := range group.IPs {
 			firstIP = k
 			break
 		}
-		matched, provider, _, _ := cdnClient.Check(net.ParseIP(firstIP))
-		isCDN := matched
-
-		if *filterCDN && isCDN {
+		matched, provider, _, _ := cdnClient.Check(parseAddr(firstIP))
+		if filterCDN && matched {
 			continue
 		}
 
-		// Logic: If a /24 subnet has hundreds of host associations, it's a Cluster.
-		// If it only has 1 or 2, it's a specific server (The "Better" Target).
-		status := "\033[32m[UNIQUE ORIGIN]\033[0m"
-		if isCDN {
-			status = fmt.Sprintf("\033[31m[CDN: %s]\033[0m", provider)
-		} else if group.Hosts > 10 {
-			status = "\033[33m[SHARED INFRA]\033[0m"
+		// With -filter, addresses shared by many hosts are likely edges too
+		ips := filterByFrequency(sortedKeys(group.IPs), filterCDN)
+		if len(ips) == 0 {
+			continue
 		}
-
-		if *ipOnly {
-			for ip := range group.IPs {
-				fmt.Println(ip)
-			}
-		} else if *urlOnly {
-			for ip := range group.IPs {
-				for _, domain := range ipRegistry[ip] {
-					fmt.Println(domain)
-				}
-			}
-		} else {
-			fmt.Printf("%-18s %s\n", cidr, status)
-			for ip := range group.IPs {
-				fmt.Printf("  └── %-15s (%d subdomains)\n", ip, len(ipRegistry[ip]))
-			}
-			fmt.Println()
+		report := subnetReport{CIDR: cidr, IPs: ips, Shared: group.Hosts > 10}
+		if matched {
+			report.CDN = provider
 		}
+		reports = append(reports, report)
 	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].CIDR < reports[j].CIDR })
+	return reports
 }
 
-// IPDetail tracks IP and associated domains
-type IPDetail struct {
-	IP      string
-	Domains []string
+// uniqueOrigins returns the addresses of subnets that are neither CDN nor
+// shared infrastructure: specific servers, the better targets
+func uniqueOrigins(reports []subnetReport) []string {
+	var ips []string
+	for _, r := range reports {
+		if r.CDN == "" && !r.Shared {
+			ips = append(ips, r.IPs...)
+		}
+	}
+	return ips
 }
 
-// SubnetGroup groups IPs by /24 subnet
-type SubnetGroup struct {
-	IPs   map[string]bool
-	Hosts int
+// parseAddr parses an IP or, for SPF-style entries, the network address of a CIDR
+func parseAddr(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if _, network, err := net.ParseCIDR(s); err == nil {
+		return network.IP
+	}
+	return nil
 }
 
-// createOutput is a HELPER function, it should be simple and clean.
-func createOutput(domain, ext string) *os.File {
-	filename := fmt.Sprintf("%s_recon.%s", domain, ext)
-	f, err := os.Create(filename)
-	if err != nil {
-		fmt.Printf("[!] Could not create %s: %v\n", filename, err)
-		return nil
+// subnetOf returns the /24 containing an IPv4 address, or the /v6Bits network
+// containing an IPv6 one (e.g. 2001:db8:1::/48)
+func subnetOf(s string, v6Bits int) (string, bool) {
+	ip := parseAddr(s)
+	if ip == nil {
+		return "", false
 	}
-
-	switch ext {
-	case "csv":
-		fmt.Fprintln(f, "subdomain,ips,resolver")
-	case "xml":
-		fmt.Fprintln(f, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<subdomains>")
-	case "grep":
-		fmt.Fprintf(f, "# Subscratcher Grepable Report for %s\n", domain)
+	if v4 := ip.To4(); v4 != nil {
+		mask := net.CIDRMask(24, 32)
+		return (&net.IPNet{IP: v4.Mask(mask), Mask: mask}).String(), true
 	}
-	return f
+	mask := net.CIDRMask(v6Bits, 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String(), true
 }
 
-// checkSPFLeaks analyzes SPF/TXT records for potential origin IP leaks
-func checkSPFLeaks(domain string, ipOnly, silent bool) {
-	txts, err := net.LookupTXT(domain)
+// logScope appends a scope refusal to scratch_scope.log
+func logScope(msg string) {
+	fileMutex.Lock()
+	defer fileMutex.Unlock()
+	f, err := os.OpenFile("scratch_scope.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		if !silent {
-			fmt.Printf("[!] No TXT records found for %s\n", domain)
-		}
 		return
 	}
+	defer f.Close()
+	fmt.Fprintf(f, "[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), msg)
+}
 
-	for _, txt := range txts {
-		if strings.Contains(txt, "ip4:") {
-			parts := strings.Split(txt, " ")
-			for _, p := range parts {
-				if strings.HasPrefix(p, "ip4:") {
-					ip := strings.TrimPrefix(p, "ip4:")
-					registerIP(ip, domain, "SPF Leak")
+// openOutputs creates <name>_recon.<ext> for every enabled format. keyed files
+// hold several domains, so their records lead with the apex.
+func openOutputs(name string, formats map[string]bool, resume, keyed bool) map[string]*os.File {
+	files := make(map[string]*os.File)
+	for ext, on := range formats {
+		if !on {
+			continue
+		}
+		if f := createOutput(name, ext, resume, keyed); f != nil {
+			files[ext] = f
+		}
+	}
+	return files
+}
 
-					if ipOnly {
-						fmt.Println(ip)
-					} else if !silent {
-						fmt.Printf("%s [\033[33mSPF Leak\033[0m]\n", ip)
-					}
-				}
-			}
+// closeOutputs finishes the XML document and closes every file
+func closeOutputs(files map[string]*os.File) {
+	for ext, f := range files {
+		if ext == "xml" {
+			fmt.Fprintln(f, "</subdomains>")
 		}
+		f.Close()
 	}
 }
 
-// fetchCTSubdomains queries crt.sh for certificate transparency subdomains
-func fetchCTSubdomains(domain string) []string {
-	var subs []string
-	url := fmt.Sprintf("https://crt.sh/?q=%%.%s&output=json", domain)
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Get(url)
+// createOutput is a HELPER function, it should be simple and clean.
+func createOutput(domain, ext string, resume, keyed bool) *os.File {
+	filename := fmt.Sprintf("%s_recon.%s", domain, ext)
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(filename, flags, 0o644)
 	if err != nil {
-		return subs
+		fmt.Printf("[!] Could not create %s: %v\n", filename, err)
+		return nil
 	}
-	defer resp.Body.Close()
-
-	var results []struct {
-		NameValue string `json:"name_value"`
+	// A resumed scan appends to the files of the interrupted run, headers included
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		return f
 	}
-	json.NewDecoder(resp.Body).Decode(&results)
 
-	for _, res := range results {
-		s := strings.Replace(res.NameValue, "*.", "", -1)
-		subs = append(subs, s)
+	switch ext {
+	case "csv":
+		if keyed {
+			fmt.Fprint(f, "apex,")
+		}
+		fmt.Fprintln(f, "subdomain,ips,resolver,source,chain")
+	case "xml":
+		fmt.Fprintln(f, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<subdomains>")
+	case "grep":
+		fmt.Fprintf(f, "# Subscratcher Grepable Report for %s\n", domain)
 	}
-	return subs
+	return f
 }
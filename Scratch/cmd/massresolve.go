@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// dnsEngine is the shared asynchronous resolver; nil means queries fall back to
+// a one-shot dns.Client per lookup
+var dnsEngine *massResolver
+
+var errQueryTimeout = errors.New("query timed out")
+
+// massResolver multiplexes many in-flight queries over a small pool of
+// long-lived UDP sockets, matching answers back to callers by transaction ID
+type massResolver struct {
+	conns    []*net.UDPConn
+	timeout  time.Duration
+	retries  int
+	mu       sync.Mutex
+	inflight map[inflightKey]*pendingQuery
+	next     uint32
+	sent     int64
+	done     chan struct{}
+}
+
+// inflightKey identifies a query by the socket it left on and its transaction ID
+type inflightKey struct {
+	sock int
+	id   uint16
+}
+
+// pendingQuery is one outstanding question and its retry state
+type pendingQuery struct {
+	key      inflightKey
+	msg      *dns.Msg
+	target   string
+	resolver string
+	addr     *net.UDPAddr
+	sentAt   time.Time
+	attempt  int
+	result   chan queryOutcome
+}
+
+type queryOutcome struct {
+	res *DNSResult
+	err error
+}
+
+// newMassResolver opens the socket pool and starts the reader and timeout loops
+func newMassResolver(sockets int, timeout time.Duration, retries int) (*massResolver, error) {
+	if sockets <= 0 {
+		sockets = 1
+	}
+	m := &massResolver{
+		timeout:  timeout,
+		retries:  retries,
+		inflight: make(map[inflightKey]*pendingQuery),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < sockets; i++ {
+		conn, err := net.ListenUDP("udp", nil)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		conn.SetReadBuffer(4 << 20)
+		m.conns = append(m.conns, conn)
+		go m.readLoop(i, conn)
+	}
+	go m.timeoutLoop()
+	return m, nil
+}
+
+// Close stops the engine and fails any queries still in flight
+func (m *massResolver) Close() {
+	select {
+	case <-m.done:
+		return
+	default:
+		close(m.done)
+	}
+	for _, c := range m.conns {
+		c.Close()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, q := range m.inflight {
+		delete(m.inflight, key)
+		q.result <- queryOutcome{err: net.ErrClosed}
+	}
+}
+
+// Sent returns the number of packets written, including retries
+func (m *massResolver) Sent() int64 {
+	return atomic.LoadInt64(&m.sent)
+}
+
+// Exchange queues a question and blocks until it is answered, retried out or the engine closes
+func (m *massResolver) Exchange(target string, qtype uint16, resolverAddr string) (*DNSResult, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(target), qtype)
+	msg.RecursionDesired = true
+
+	q := &pendingQuery{
+		msg:    msg,
+		target: target,
+		result: make(chan queryOutcome, 1),
+	}
+	if err := m.send(q, resolverAddr); err != nil {
+		return nil, err
+	}
+
+	out := <-q.result
+	return out.res, out.err
+}
+
+// send assigns a free transaction ID on the next socket and writes the packet
+func (m *massResolver) send(q *pendingQuery, resolverAddr string) error {
+	addr, err := net.ResolveUDPAddr("udp", resolverAddr)
+	if err != nil {
+		return err
+	}
+
+	sock := int(atomic.AddUint32(&m.next, 1) % uint32(len(m.conns)))
+
+	m.mu.Lock()
+	key := inflightKey{sock: sock}
+	for {
+		key.id = uint16(rand.Intn(1 << 16))
+		if _, taken := m.inflight[key]; !taken {
+			break
+		}
+	}
+	q.key = key
+	q.msg.Id = key.id
+	q.resolver = resolverAddr
+	q.addr = addr
+	q.sentAt = time.Now()
+	m.inflight[key] = q
+	m.mu.Unlock()
+
+	packed, err := q.msg.Pack()
+	if err == nil {
+		_, err = m.conns[sock].WriteToUDP(packed, addr)
+	}
+	if err != nil {
+		m.mu.Lock()
+		delete(m.inflight, key)
+		m.mu.Unlock()
+		return err
+	}
+	atomic.AddInt64(&m.sent, 1)
+	return nil
+}
+
+// readLoop matches answers on one socket back to their pending query
+func (m *massResolver) readLoop(sock int, conn *net.UDPConn) {
+	buf := make([]byte, dns.MaxMsgSize)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		resp := new(dns.Msg)
+		if err := resp.Unpack(buf[:n]); err != nil || len(resp.Question) == 0 {
+			continue
+		}
+
+		key := inflightKey{sock: sock, id: resp.Id}
+		m.mu.Lock()
+		q, ok := m.inflight[key]
+		// Ignore late or spoofed answers that don't match what we asked and whom
+		if !ok || !from.IP.Equal(q.addr.IP) || from.Port != q.addr.Port ||
+			!strings.EqualFold(resp.Question[0].Name, q.msg.Question[0].Name) {
+			m.mu.Unlock()
+			continue
+		}
+		delete(m.inflight, key)
+		m.mu.Unlock()
+
+		rtt := time.Since(q.sentAt)
+		if resp.Truncated {
+			go m.retryTCP(q, rtt)
+			continue
+		}
+		res := newDNSResult(q.target, q.resolver, resp, rtt)
+		health.observe(q.resolver, res, nil)
+		q.result <- queryOutcome{res: res}
+	}
+}
+
+// retryTCP re-asks a truncated answer over TCP to the same resolver
+func (m *massResolver) retryTCP(q *pendingQuery, rtt time.Duration) {
+	c := &dns.Client{Net: "tcp", Timeout: m.timeout}
+	resp, tcpRTT, err := c.Exchange(q.msg, q.resolver)
+	if err != nil {
+		health.observe(q.resolver, nil, err)
+		q.result <- queryOutcome{err: err}
+		return
+	}
+	res := newDNSResult(q.target, q.resolver, resp, rtt+tcpRTT)
+	health.observe(q.resolver, res, nil)
+	q.result <- queryOutcome{res: res}
+}
+
+// timeoutLoop charges expired queries to their resolver and resends them
+// elsewhere until retries run out
+func (m *massResolver) timeoutLoop() {
+	tick := m.timeout / 4
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			var expired []*pendingQuery
+			m.mu.Lock()
+			for key, q := range m.inflight {
+				if now.Sub(q.sentAt) >= m.timeout {
+					delete(m.inflight, key)
+					expired = append(expired, q)
+				}
+			}
+			m.mu.Unlock()
+
+			for _, q := range expired {
+				health.observe(q.resolver, nil, errQueryTimeout)
+				if q.attempt >= m.retries {
+					q.result <- queryOutcome{err: errQueryTimeout}
+					continue
+				}
+				q.attempt++
+				next := getRandomResolver(q.resolver)
+				if next == "" || resolverTransport(next) != transportUDP {
+					next = q.resolver
+				}
+				if err := m.send(q, next); err != nil {
+					q.result <- queryOutcome{err: err}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// zoneWalk is what DNSSEC denial-of-existence records reveal about a zone.
+// NSEC zones hand over their names directly; NSEC3 zones only give hashes,
+// which are matched offline against candidate names.
+type zoneWalk struct {
+	Domain string
+	Signed bool
+	Mode   string // "NSEC", "NSEC3" or "" when the denial type is unknown
+
+	// NSEC3 parameters and every owner/next hash seen
+	Hash       uint8
+	Iterations uint16
+	Salt       string
+	Hashes     map[string]bool
+	cracked    map[string]string // hash -> name
+}
+
+// queryDNSSEC asks for target with the DO bit set so signed zones include their
+// NSEC/NSEC3 and DNSKEY records. CD is set because we want the records even if
+// a validating resolver can't verify them.
+func queryDNSSEC(target string, qtype uint16, resolver string) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(target), qtype)
+	m.RecursionDesired = true
+	m.CheckingDisabled = true
+	m.SetEdns0(4096, true)
+
+	resp, rtt, err := exchangeMsg(m, resolver)
+	if err != nil {
+		health.observe(resolver, nil, err)
+		return nil, err
+	}
+	health.observe(resolver, newDNSResult(target, resolver, resp, rtt), nil)
+	return resp, nil
+}
+
+// detectDNSSEC checks the apex for a DNSKEY and, if signed, asks for a name
+// that can't exist to learn whether denials use NSEC or NSEC3
+func detectDNSSEC(domain string) *zoneWalk {
+	w := &zoneWalk{Domain: strings.ToLower(domain), Hashes: make(map[string]bool), cracked: make(map[string]string)}
+
+	resp, err := queryDNSSEC(domain, dns.TypeDNSKEY, getRandomResolver())
+	if err != nil {
+		return w
+	}
+	for _, rr := range resp.Answer {
+		if _, ok := rr.(*dns.DNSKEY); ok {
+			w.Signed = true
+			break
+		}
+	}
+	if !w.Signed {
+		return w
+	}
+
+	for attempt := 0; attempt < 3 && w.Mode == ""; attempt++ {
+		resp, err := queryDNSSEC(randomLabel(12)+"."+domain, dns.TypeA, getRandomResolver())
+		if err != nil {
+			continue
+		}
+		for _, rr := range resp.Ns {
+			switch v := rr.(type) {
+			case *dns.NSEC:
+				w.Mode = "NSEC"
+			case *dns.NSEC3:
+				w.Mode = "NSEC3"
+				w.Hash, w.Iterations, w.Salt = v.Hash, v.Iterations, v.Salt
+			}
+		}
+	}
+	return w
+}
+
+// walkNSEC follows the NSEC chain from the apex until it wraps around, leaves
+// the zone or hits limit queries. Returns the owner names in chain order.
+func (w *zoneWalk) walkNSEC(cfg *scanConfig, limit int) []string {
+	var names []string
+	seen := map[string]bool{w.Domain: true}
+	current := w.Domain
+	for i := 0; i < limit; i++ {
+		next, ok := nextNSEC(current, cfg.Limiter)
+		if !ok || seen[next] || !inZone(next, w.Domain) {
+			break
+		}
+		seen[next] = true
+		names = append(names, next)
+		current = next
+	}
+	return names
+}
+
+// nextNSEC returns the next owner after name. It asks for the NSEC record
+// directly, then falls back to the NXDOMAIN proof for "\000.name", which is
+// the first possible name after it and so is covered by name's own NSEC.
+// Each query waits on limiter.
+func nextNSEC(name string, limiter <-chan struct{}) (string, bool) {
+	queries := []struct {
+		qname string
+		qtype uint16
+	}{
+		{name, dns.TypeNSEC},
+		{`\000.` + name, dns.TypeA},
+	}
+	for _, q := range queries {
+		if limiter != nil {
+			<-limiter
+		}
+		resp, err := queryDNSSEC(q.qname, q.qtype, getRandomResolver())
+		if err != nil {
+			continue
+		}
+		for _, rr := range append(resp.Answer, resp.Ns...) {
+			nsec, ok := rr.(*dns.NSEC)
+			if ok && strings.EqualFold(strings.TrimSuffix(nsec.Hdr.Name, "."), name) {
+				return strings.ToLower(strings.TrimSuffix(nsec.NextDomain, ".")), true
+			}
+		}
+	}
+	return "", false
+}
+
+// collectNSEC3 gathers hashes from the NXDOMAIN proofs for random names. It
+// stops when the hashed chain closes, when limit queries are spent or when
+// 50 queries in a row reveal nothing new.
+func (w *zoneWalk) collectNSEC3(cfg *scanConfig, limit int) {
+	next := make(map[string]string)
+	stale := 0
+	for i := 0; i < limit && stale < 50; i++ {
+		if cfg.Limiter != nil {
+			<-cfg.Limiter
+		}
+		resp, err := queryDNSSEC(randomLabel(12)+"."+w.Domain, dns.TypeA, getRandomResolver())
+		if err != nil {
+			continue
+		}
+
+		before := len(w.Hashes)
+		for _, rr := range resp.Ns {
+			v, ok := rr.(*dns.NSEC3)
+			if !ok || v.Hash != w.Hash || v.Iterations != w.Iterations || !strings.EqualFold(v.Salt, w.Salt) {
+				continue
+			}
+			owner := strings.ToUpper(dns.SplitDomainName(v.Hdr.Name)[0])
+			w.Hashes[owner] = true
+			w.Hashes[strings.ToUpper(v.NextDomain)] = true
+			next[owner] = strings.ToUpper(v.NextDomain)
+		}
+		if len(w.Hashes) == before {
+			stale++
+		} else {
+			stale = 0
+		}
+		if chainClosed(next) {
+			break
+		}
+	}
+}
+
+// chainClosed reports whether every hash seen as a successor is also a known owner
+func chainClosed(next map[string]string) bool {
+	if len(next) == 0 {
+		return false
+	}
+	for _, n := range next {
+		if _, ok := next[n]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// crackNSEC3 hashes candidate names with the zone's parameters and emits the
+// ones that match a collected hash. Returns the number of new matches.
+func (w *zoneWalk) crackNSEC3(cfg *scanConfig, candidates []string) int {
+	if w == nil || w.Mode != "NSEC3" || len(w.Hashes) == 0 {
+		return 0
+	}
+	matched := 0
+	for _, name := range candidates {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		h := dns.HashName(dns.Fqdn(name), w.Hash, w.Iterations, w.Salt)
+		if h == "" || !w.Hashes[h] {
+			continue
+		}
+		if _, done := w.cracked[h]; done {
+			continue
+		}
+		w.cracked[h] = name
+		matched++
+		emitWalkedName(cfg, name)
+	}
+	return matched
+}
+
+// remaining returns how many collected NSEC3 hashes are still unmatched
+func (w *zoneWalk) remaining() int {
+	return len(w.Hashes) - len(w.cracked)
+}
+
+// emitWalkedName resolves a name learned from the zone's denial records and
+// reports it with source "NSEC". Names without addresses are only listed.
+func emitWalkedName(cfg *scanConfig, name string) {
+	if strings.HasPrefix(name, "*.") {
+		if !cfg.Silent {
+			fmt.Printf("\033[33m[+] Zone wildcard:\033[0m %s\n", name)
+		}
+		return
+	}
+	if cfg.Limiter != nil {
+		<-cfg.Limiter
+	}
+	res, err := lookupHost(name, getRandomResolver())
+	if err != nil || !res.Exists() || len(res.IPs()) == 0 {
+		if !cfg.Silent {
+			fmt.Printf("[*] NSEC name without address: %s\n", name)
+		}
+		return
+	}
+	emitFound(cfg, name, res.IPs(), getResolverName(res.Resolver), "NSEC")
+}
+
+// walkZone runs the NSEC walk or NSEC3 collection for a signed zone and
+// cracks NSEC3 hashes against the wordlist
+func walkZone(cfg *scanConfig, domain string, words *wordlist, limit int) *zoneWalk {
+	w := detectDNSSEC(domain)
+	if !w.Signed {
+		if !cfg.Silent {
+			fmt.Println("[-] Zone is not DNSSEC signed")
+		}
+		return w
+	}
+
+	switch w.Mode {
+	case "NSEC":
+		names := w.walkNSEC(cfg, limit)
+		if !cfg.Silent {
+			fmt.Printf("\033[1m\033[31m[!] NSEC chain walked:\033[0m %d name(s)\n", len(names))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			emitWalkedName(cfg, name)
+		}
+	case "NSEC3":
+		w.collectNSEC3(cfg, limit)
+		if !cfg.Silent {
+			fmt.Printf("[*] NSEC3 zone (alg %d, %d iterations, salt %q): collected %d hash(es)\n", w.Hash, w.Iterations, w.Salt, len(w.Hashes))
+		}
+		// Crack in batches so the wordlist is never held in memory
+		candidates := []string{domain}
+		n := 0
+		words.each(func(word string) bool {
+			if candidates = append(candidates, word+"."+domain); len(candidates) == 10000 {
+				n += w.crackNSEC3(cfg, candidates)
+				candidates = candidates[:0]
+			}
+			return true
+		})
+		n += w.crackNSEC3(cfg, candidates)
+		if !cfg.Silent {
+			fmt.Printf("[+] Matched %d NSEC3 hash(es) against the wordlist, %d remaining\n", n, w.remaining())
+		}
+	default:
+		if !cfg.Silent {
+			fmt.Println("[-] Zone is signed but denial records could not be retrieved")
+		}
+	}
+	return w
+}
+
+// inZone reports whether name is domain or below it
+func inZone(name, domain string) bool {
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
@@ -16,12 +16,14 @@ var resolverNames = map[string]string{
 	"149.112.112.112:53": "Quad9-2",
 }
 
-func getRandomResolver() string {
+// getRandomResolver picks a healthy resolver, weighted by its track record.
+// Resolvers listed in exclude are skipped; "" means none are left.
+func getRandomResolver(exclude ...string) string {
 	keys := make([]string, 0, len(resolverNames))
 	for k := range resolverNames {
 		keys = append(keys, k)
 	}
-	return keys[rand.Intn(len(keys))]
+	return health.pick(keys, exclude...)
 }
 
 func getResolverName(ip string) string {
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ipClass is how one address of a found host was classified
+type ipClass struct {
+	IP       string `json:"ip"`
+	CDN      string `json:"cdn,omitempty"`
+	Kind     string `json:"cdn_kind,omitempty"` // cdn, waf or cloud
+	Wildcard bool   `json:"wildcard,omitempty"`
+	Origin   bool   `json:"origin,omitempty"`
+}
+
+// classifyIPs tags each address as CDN, wildcard pool or likely origin. A nil
+// wildcards cache skips the wildcard pool check.
+func classifyIPs(ips []string, wildcards *wildcardCache) []ipClass {
+	var classes []ipClass
+	for _, ip := range ips {
+		c := ipClass{IP: ip}
+		if matched, provider, kind, err := cdnClient.Check(net.ParseIP(ip)); matched && err == nil {
+			c.CDN, c.Kind = provider, kind
+		} else if wildcards.knownIP(ip) {
+			c.Wildcard = true
+		} else {
+			c.Origin = true
+		}
+		classes = append(classes, c)
+	}
+	return classes
+}
+
+// hopRecord is one CNAME hop in a JSON record
+type hopRecord struct {
+	Name     string `json:"name"`
+	Class    string `json:"class,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
+// hostRecord is the JSON Lines record for a discovered host
+type hostRecord struct {
+	Type        string      `json:"type"`
+	Apex        string      `json:"apex"`
+	Host        string      `json:"host"`
+	IPs         []string    `json:"ips"`
+	RecordTypes []string    `json:"record_types"`
+	Chain       []hopRecord `json:"cname_chain,omitempty"`
+	Addresses   []ipClass   `json:"classification"`
+	Resolver    string      `json:"resolver,omitempty"`
+	Source      string      `json:"source"`
+	Sources     []string    `json:"sources"` // every source that reported the host so far
+	Time        time.Time   `json:"time"`
+}
+
+// takeoverRecord is the JSON Lines record for a takeover finding
+type takeoverRecord struct {
+	Type       string    `json:"type"`
+	Apex       string    `json:"apex"`
+	Host       string    `json:"host"`
+	Chain      []string  `json:"cname_chain"`
+	Service    string    `json:"service"`
+	Reason     string    `json:"reason"`
+	Confidence string    `json:"confidence"`
+	Time       time.Time `json:"time"`
+}
+
+// jsonWriter writes one JSON object per line to every sink, once per host.
+// Every record carries the apex domain being scanned.
+type jsonWriter struct {
+	mu    sync.Mutex
+	apex  string
+	sinks []io.Writer
+	hosts map[string]bool
+}
+
+// jsonOut receives every finding when -json or -jsonl is set (nil otherwise)
+var jsonOut *jsonWriter
+
+func newJSONWriter(apex string, sinks ...io.Writer) *jsonWriter {
+	return &jsonWriter{apex: apex, sinks: sinks, hosts: make(map[string]bool)}
+}
+
+// write encodes rec on a single line to every sink
+func (w *jsonWriter) write(rec interface{}) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	for _, sink := range w.sinks {
+		fmt.Fprintf(sink, "%s\n", line)
+	}
+}
+
+// host records a discovered host the first time it is seen, whichever phase
+// found it. A nil wildcards cache skips the wildcard pool check.
+func (w *jsonWriter) host(host hostView, wildcards *wildcardCache, resolver, source string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hosts[host.Name] {
+		return
+	}
+	w.hosts[host.Name] = true
+
+	rec := hostRecord{Type: "host", Apex: w.apex, Host: host.Name, IPs: host.IPs, Addresses: classifyIPs(host.IPs, wildcards), Resolver: resolver, Source: source, Sources: host.Sources, Time: time.Now().UTC()}
+	hasA, hasAAAA := false, false
+	for _, ip := range host.IPs {
+		if strings.Contains(ip, ":") {
+			hasAAAA = true
+		} else {
+			hasA = true
+		}
+	}
+	for _, hop := range host.Chain {
+		rec.Chain = append(rec.Chain, hopRecord{Name: hop.Name, Class: hop.Class, Provider: hop.Provider})
+	}
+	if len(rec.Chain) > 0 {
+		rec.RecordTypes = append(rec.RecordTypes, "CNAME")
+	}
+	if hasA {
+		rec.RecordTypes = append(rec.RecordTypes, "A")
+	}
+	if hasAAAA {
+		rec.RecordTypes = append(rec.RecordTypes, "AAAA")
+	}
+	w.write(rec)
+}
+
+// takeover records a takeover finding
+func (w *jsonWriter) takeover(f *takeoverFinding) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.write(takeoverRecord{Type: "takeover", Apex: w.apex, Host: f.Host, Chain: f.Chain, Service: f.Service, Reason: f.Reason, Confidence: f.Confidence, Time: time.Now().UTC()})
+}
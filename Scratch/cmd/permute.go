@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// envTokens are the environment markers most often bolted onto hostnames
+var envTokens = []string{"dev", "develop", "staging", "stage", "stg", "test", "qa", "uat", "prod", "preprod", "int", "internal", "beta", "demo", "old", "new", "v2"}
+
+var digitRun = regexp.MustCompile(`\d+`)
+
+// permutationSet collects unique candidates up to a cap
+type permutationSet struct {
+	domain string
+	known  map[string]bool
+	out    []string
+	limit  int
+}
+
+// add queues sub.domain if it is new, valid and under the cap. Returns false once the cap is hit.
+func (p *permutationSet) add(sub string) bool {
+	if len(p.out) >= p.limit {
+		return false
+	}
+	sub = strings.Trim(strings.ToLower(sub), ".-")
+	if sub == "" || strings.Contains(sub, "..") || strings.Contains(sub, "--") {
+		return true
+	}
+	for _, label := range strings.Split(sub, ".") {
+		if len(label) > 63 {
+			return true
+		}
+	}
+	host := sub + "." + p.domain
+	if !p.known[host] {
+		p.known[host] = true
+		p.out = append(p.out, host)
+	}
+	return true
+}
+
+// generatePermutations mutates discovered hosts into new candidates: numeric
+// increments, environment prefixes/suffixes, dash/dot swaps and wordlist
+// insertion. At most limit candidates are returned and only the first
+// maxWords wordlist entries are used for insertion.
+func generatePermutations(hosts []string, domain string, words []string, limit, maxWords int) []string {
+	suffix := "." + domain
+	known := make(map[string]bool)
+	var subs []string
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSuffix(h, "."))
+		known[h] = true
+		if strings.HasSuffix(h, suffix) {
+			subs = append(subs, strings.TrimSuffix(h, suffix))
+		}
+	}
+	sort.Strings(subs)
+
+	if len(words) > maxWords {
+		words = words[:maxWords]
+	}
+
+	p := &permutationSet{domain: domain, known: known, limit: limit}
+
+	// Cheap, high-yield rules first so the cap cuts off word insertion rather than them
+	rules := []func(sub string) []string{
+		numericIncrements,
+		envAlterations,
+		dashDotSwaps,
+		func(sub string) []string { return wordInsertions(sub, words) },
+	}
+	for _, rule := range rules {
+		for _, sub := range subs {
+			for _, candidate := range rule(sub) {
+				if !p.add(candidate) {
+					return p.out
+				}
+			}
+		}
+	}
+	return p.out
+}
+
+// numericIncrements bumps every number in the leftmost label (api2 -> api1, api3, api4)
+// and tries a trailing number on labels without one
+func numericIncrements(sub string) []string {
+	label, rest := splitLeftmost(sub)
+	locs := digitRun.FindAllStringIndex(label, -1)
+	if len(locs) == 0 {
+		return []string{label + "1" + rest, label + "2" + rest, label + "-1" + rest}
+	}
+
+	var out []string
+	for _, loc := range locs {
+		num := label[loc[0]:loc[1]]
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			continue
+		}
+		for _, delta := range []int{-1, 1, 2} {
+			if n+delta < 0 {
+				continue
+			}
+			// Keep zero padding (web01 -> web02)
+			next := fmt.Sprintf("%0*d", len(num), n+delta)
+			out = append(out, label[:loc[0]]+next+label[loc[1]:]+rest)
+		}
+	}
+	return out
+}
+
+// envAlterations adds or swaps environment markers (api -> dev-api, api-staging, dev.api)
+func envAlterations(sub string) []string {
+	label, rest := splitLeftmost(sub)
+	var out []string
+	for _, env := range envTokens {
+		if label == env {
+			continue
+		}
+		out = append(out, env+"-"+label+rest, label+"-"+env+rest, env+"."+sub, label+env+rest)
+	}
+	// api-dev -> api-staging: replace an existing marker with the others
+	parts := strings.Split(label, "-")
+	for i, part := range parts {
+		if !slices.Contains(envTokens, part) {
+			continue
+		}
+		for _, env := range envTokens {
+			if env == part {
+				continue
+			}
+			swapped := slices.Clone(parts)
+			swapped[i] = env
+			out = append(out, strings.Join(swapped, "-")+rest)
+		}
+	}
+	return out
+}
+
+// dashDotSwaps turns api-dev into api.dev and dev.api into dev-api
+func dashDotSwaps(sub string) []string {
+	var out []string
+	label, rest := splitLeftmost(sub)
+	if strings.Contains(label, "-") {
+		out = append(out, strings.ReplaceAll(label, "-", ".")+rest)
+	}
+	if rest != "" {
+		out = append(out, label+"-"+strings.TrimPrefix(rest, "."))
+	}
+	return out
+}
+
+// wordInsertions combines wordlist entries with the host (admin.api, admin-api, api-admin)
+func wordInsertions(sub string, words []string) []string {
+	label, rest := splitLeftmost(sub)
+	var out []string
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if w == "" || w == label {
+			continue
+		}
+		out = append(out, w+"."+sub, w+"-"+label+rest, label+"-"+w+rest)
+	}
+	return out
+}
+
+// splitLeftmost separates "api.dev" into "api" and ".dev"
+func splitLeftmost(sub string) (string, string) {
+	if idx := strings.Index(sub, "."); idx != -1 {
+		return sub[:idx], sub[idx:]
+	}
+	return sub, ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestEnvAlterationsSwapsWholeParts(t *testing.T) {
+	out := envAlterations("intranet-int.corp")
+
+	if !slices.Contains(out, "intranet-dev.corp") {
+		t.Errorf("marker part not swapped: %v", out)
+	}
+	for _, bad := range []string{"devranet-int.corp", "stagingranet-int.corp"} {
+		if slices.Contains(out, bad) {
+			t.Errorf("marker replaced inside another part: %s", bad)
+		}
+	}
+}
+
+func TestEnvAlterationsSwapsMarker(t *testing.T) {
+	out := envAlterations("api-dev")
+	for _, want := range []string{"api-staging", "api-qa", "staging-api-dev"} {
+		if !slices.Contains(out, want) {
+			t.Errorf("missing %s in %v", want, out)
+		}
+	}
+}
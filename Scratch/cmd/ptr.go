@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// ptrHit is one reverse record that passed the domain/keyword filter
+type ptrHit struct {
+	IP   string
+	Name string
+}
+
+// ptrNetworks widens each IPv4 address to its /prefix network, deduplicated.
+// IPv6 networks are far too large to sweep and are skipped.
+func ptrNetworks(ips []string, prefix int) []*net.IPNet {
+	seen := make(map[string]bool)
+	var networks []*net.IPNet
+	mask := net.CIDRMask(prefix, 32)
+	for _, s := range ips {
+		ip := parseAddr(s).To4()
+		if ip == nil {
+			continue
+		}
+		network := &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+		if !seen[network.String()] {
+			seen[network.String()] = true
+			networks = append(networks, network)
+		}
+	}
+	sort.Slice(networks, func(i, j int) bool { return networks[i].String() < networks[j].String() })
+	return networks
+}
+
+// ptrKeywords returns the keywords that make an out-of-scope PTR name interesting.
+// With no explicit list, the domain's first label is used (acme for acme.com).
+func ptrKeywords(domain, list string) []string {
+	var keywords []string
+	for _, k := range strings.Split(list, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	if len(keywords) == 0 {
+		if label, _, _ := strings.Cut(domain, "."); label != "" {
+			keywords = append(keywords, strings.ToLower(label))
+		}
+	}
+	return keywords
+}
+
+// ptrRelevant keeps names under the target domain or containing a keyword
+func ptrRelevant(name, domain string, keywords []string) bool {
+	if inZone(name, domain) {
+		return true
+	}
+	for _, k := range keywords {
+		if strings.Contains(name, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// sweepPTR issues a PTR query for every address in networks using cfg's worker
+// count and rate limiter. Returns the relevant hits sorted by IP.
+func sweepPTR(cfg *scanConfig, networks []*net.IPNet, keywords []string) []ptrHit {
+	ips := make(chan string)
+	var mu sync.Mutex
+	var hits []ptrHit
+	var wg sync.WaitGroup
+
+	for i := 0; i < cfg.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range ips {
+				if cfg.Limiter != nil {
+					<-cfg.Limiter
+				}
+				sleepWithJitter(cfg.Delay, cfg.Jitter)
+
+				arpa, err := dns.ReverseAddr(ip)
+				if err != nil {
+					continue
+				}
+				res, err := queryDNS(arpa, dns.TypePTR, getRandomResolver())
+				if err != nil || !res.Exists() {
+					continue
+				}
+				for _, rec := range res.Answers {
+					if rec.Type != "PTR" || !ptrRelevant(rec.Value, cfg.Domain, keywords) {
+						continue
+					}
+					mu.Lock()
+					hits = append(hits, ptrHit{IP: ip, Name: rec.Value})
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, network := range networks {
+		for ip := network.IP.Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			ips <- ip.String()
+		}
+	}
+	close(ips)
+	wg.Wait()
+
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := parseAddr(hits[i].IP).To4(), parseAddr(hits[j].IP).To4()
+		if c := strings.Compare(string(a), string(b)); c != 0 {
+			return c < 0
+		}
+		return hits[i].Name < hits[j].Name
+	})
+	return hits
+}
+
+// nextIP returns ip + 1; it wraps to all zeros after the last address
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// runPTRSweep sweeps the networks around the unique-origin IPs and resolves every
+// relevant hostname, emitting it to the outputs with source "PTR"
+func runPTRSweep(cfg *scanConfig, origins []string, prefix int, keywords []string) {
+	networks := ptrNetworks(origins, prefix)
+	if len(networks) == 0 {
+		if !cfg.Silent {
+			fmt.Println("[-] No IPv4 unique-origin subnets to sweep")
+		}
+		return
+	}
+	if !cfg.Silent {
+		var names []string
+		for _, n := range networks {
+			names = append(names, n.String())
+		}
+		fmt.Printf("[*] Sweeping PTR records across %d network(s): %s\n", len(networks), strings.Join(names, ", "))
+	}
+
+	known := make(map[string]bool)
+	for _, host := range assets.hostNames() {
+		known[host] = true
+	}
+
+	hits := sweepPTR(cfg, networks, keywords)
+	seen := make(map[string]bool)
+	for _, hit := range hits {
+		if !inScope.AllowHost(hit.Name, "PTR") {
+			continue
+		}
+		if !cfg.Silent {
+			tag := ""
+			if !known[hit.Name] {
+				tag = " \033[1m\033[32m[NEW]\033[0m"
+			}
+			fmt.Printf("\033[32m[+] PTR:\033[0m %-15s -> %s%s\n", hit.IP, hit.Name, tag)
+		}
+		if seen[hit.Name] {
+			continue
+		}
+		seen[hit.Name] = true
+		if cfg.Limiter != nil {
+			<-cfg.Limiter
+		}
+		res, err := lookupHost(hit.Name, getRandomResolver())
+		if err == nil && res.Exists() && len(res.IPs()) > 0 {
+			emitFound(cfg, hit.Name, res.IPs(), getResolverName(res.Resolver), "PTR")
+		}
+	}
+	if !cfg.Silent && len(hits) == 0 {
+		fmt.Println("[-] No relevant PTR records found")
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// loadResolversFile reads "resolver [name]" lines into an address -> name map.
+// A resolver is ip[:port] for UDP, or tcp://ip[:port], tls://host[:port] or an
+// https:// DoH endpoint.
+func loadResolversFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	resolvers := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		addr, err := normalizeResolverAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		name := addr
+		if len(fields) > 1 {
+			name = strings.Join(fields[1:], " ")
+		}
+		resolvers[addr] = name
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("no resolvers in %s", path)
+	}
+	return resolvers, nil
+}
+
+// normalizeResolverAddr turns "1.1.1.1", "1.1.1.1:5353", "2001:db8::1" or
+// "[2001:db8::1]:53" into a dialable host:port, keeping the scheme of
+// tcp://, tls:// and https:// entries
+func normalizeResolverAddr(s string) (string, error) {
+	switch resolverTransport(s) {
+	case transportDoH:
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" {
+			return "", fmt.Errorf("invalid DoH endpoint %q", s)
+		}
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return u.String(), nil
+	case transportDoT:
+		addr, err := hostPort(strings.TrimPrefix(s, "tls://"), "853", true)
+		return "tls://" + addr, err
+	case transportTCP:
+		addr, err := hostPort(strings.TrimPrefix(s, "tcp://"), "53", false)
+		return "tcp://" + addr, err
+	default:
+		return hostPort(strings.TrimPrefix(s, "udp://"), "53", false)
+	}
+}
+
+// hostPort adds the default port when missing. DoT may name a host (used for SNI).
+func hostPort(s, defaultPort string, allowName bool) (string, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host, port = strings.Trim(s, "[]"), defaultPort
+	}
+	if net.ParseIP(host) == nil && (!allowName || host == "") {
+		return "", fmt.Errorf("invalid resolver address %q", s)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// probeSpec is the known-answer check: a name and optionally the IP it must return
+type probeSpec struct {
+	Name     string
+	Expected string
+}
+
+// parseProbe reads "name[=ip]"
+func parseProbe(s string) probeSpec {
+	name, expected, _ := strings.Cut(s, "=")
+	return probeSpec{Name: strings.TrimSpace(name), Expected: strings.TrimSpace(expected)}
+}
+
+// resolverVerdict is the outcome of validating one resolver
+type resolverVerdict struct {
+	Addr   string
+	Answer []string
+	Reason string // empty when the resolver passed
+}
+
+// validateResolvers probes every resolver with a known name and a name that
+// must not exist, and returns the subset that answered honestly. Resolvers
+// that time out, hijack NXDOMAIN or disagree with the known answer are dropped.
+func validateResolvers(resolvers map[string]string, probe probeSpec, nxZone string, silent bool) map[string]string {
+	nxName := fmt.Sprintf("scratch-nx-%08x.%s", rand.Uint32(), nxZone)
+
+	verdicts := make([]*resolverVerdict, 0, len(resolvers))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for addr := range resolvers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			v := probeResolver(addr, probe.Name, nxName)
+			mu.Lock()
+			verdicts = append(verdicts, v)
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+
+	// Without a pinned answer, the most common answer set is taken as the truth
+	expected := probe.Expected
+	consensus := make(map[string]int)
+	voters := 0
+	for _, v := range verdicts {
+		if v.Reason == "" {
+			voters++
+			for _, ip := range v.Answer {
+				consensus[ip]++
+			}
+		}
+	}
+
+	valid := make(map[string]string)
+	sort.Slice(verdicts, func(i, j int) bool { return verdicts[i].Addr < verdicts[j].Addr })
+	for _, v := range verdicts {
+		if v.Reason == "" && !answerAgrees(v.Answer, expected, consensus, voters) {
+			v.Reason = fmt.Sprintf("stale/incorrect answer for %s: %v", probe.Name, v.Answer)
+		}
+		if v.Reason != "" {
+			if !silent {
+				fmt.Printf("  \033[31m[-] %-20s\033[0m %s\n", resolvers[v.Addr], v.Reason)
+			}
+			continue
+		}
+		valid[v.Addr] = resolvers[v.Addr]
+		if !silent {
+			fmt.Printf("  \033[32m[+] %-20s\033[0m ok\n", resolvers[v.Addr])
+		}
+	}
+	return valid
+}
+
+// probeResolver runs the known-answer and NXDOMAIN probes against one resolver
+func probeResolver(addr, knownName, nxName string) *resolverVerdict {
+	v := &resolverVerdict{Addr: addr}
+
+	// The engine retries timeouts elsewhere, so an answer from another resolver means this one is silent
+	res, err := queryDNS(knownName, dns.TypeA, addr)
+	if err == nil && res.Resolver != addr {
+		err = errQueryTimeout
+	}
+	if err != nil {
+		v.Reason = fmt.Sprintf("no response (%v)", err)
+		return v
+	}
+	if !res.Exists() {
+		v.Reason = fmt.Sprintf("%s for %s", res.RcodeName(), knownName)
+		return v
+	}
+	v.Answer = res.IPs()
+
+	res, err = queryDNS(nxName, dns.TypeA, addr)
+	if err == nil && res.Resolver != addr {
+		err = errQueryTimeout
+	}
+	if err != nil {
+		v.Reason = fmt.Sprintf("no response to NXDOMAIN probe (%v)", err)
+		return v
+	}
+	if res.Rcode != dns.RcodeNameError {
+		v.Reason = fmt.Sprintf("hijacks NXDOMAIN (%s -> %s %v)", nxName, res.RcodeName(), res.IPs())
+	}
+	return v
+}
+
+// answerAgrees checks an answer against the pinned IP, or shares at least one
+// IP with what a majority of resolvers returned
+func answerAgrees(answer []string, expected string, consensus map[string]int, voters int) bool {
+	for _, ip := range answer {
+		if expected != "" {
+			if ip == expected {
+				return true
+			}
+			continue
+		}
+		if consensus[ip]*2 > voters || voters == 1 {
+			return true
+		}
+	}
+	return false
+}
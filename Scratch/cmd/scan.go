@@ -0,0 +1,475 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanOptions carries the flag values and run-wide state every domain's scan
+// shares: the wordlists, the rate limiter and the combined output files
+type scanOptions struct {
+	MultiDomain        bool // -dL listed several domains
+	Resume             bool
+	CheckpointFile     string
+	CheckpointInterval time.Duration
+	WordlistSources    string // -w as given, which a checkpoint must match
+	Words              *wordlist
+	RecurseWords       *wordlist // -rw, nil = Words
+	Limiter            <-chan struct{}
+	V6Prefix           int
+	WildcardSamples    int
+	Threads            int
+	Delay              int
+	Jitter             int
+	Silent             bool
+	URLOnly            bool
+	IPOnly             bool
+	JSONLOut           bool
+	FilterCDN          bool
+	Formats            map[string]bool
+	Combined           string              // -combined name, "" = per-domain files
+	SharedFiles        map[string]*os.File // open -combined files
+	AXFR               bool
+	AXFRPort           string
+	DNSSEC             bool
+	WalkMax            int
+	Recursive          bool
+	MaxDepth           int
+	SPFLookups         int
+	Mail               bool
+	SMTPPort           string
+	DKIMSelectors      []string
+	Sources            []Source
+	SourceTimeout      time.Duration
+	SourceTimeouts     map[string]time.Duration
+	Permute            bool
+	PermMax            int
+	PermWords          int
+	Takeover           bool
+	Fingerprints       []takeoverFingerprint
+	TakeoverHTTP       []string
+	PTR                bool
+	PTRPrefix          int
+	PTRKeywordList     string
+}
+
+// scanDomain runs every enabled phase against one apex domain and returns its
+// checkpoint, which main removes once all domains are done. It returns nil when
+// the domain is out of scope.
+func scanDomain(domain string, opts *scanOptions) *checkpoint {
+	if !inScope.AllowHost(domain, "target") {
+		return nil
+	}
+	// Checkpoints let an interrupted scan pick up where it stopped with -resume
+	ckptPath := opts.CheckpointFile
+	if ckptPath == "" {
+		ckptPath = fmt.Sprintf("%s_recon.checkpoint", domain)
+	}
+	ckpt := newCheckpoint(ckptPath, domain, opts.WordlistSources)
+	if opts.Resume {
+		loaded, err := loadCheckpoint(ckptPath, domain, opts.WordlistSources)
+		switch {
+		case err == nil:
+			ckpt = loaded
+			if ckpt.completed("done") {
+				if !opts.Silent {
+					fmt.Printf("[*] %s was completed before the interruption, skipping\n", domain)
+				}
+				return ckpt
+			}
+			if !opts.Silent {
+				fmt.Printf("[*] Resuming from %s: %s\n", ckptPath, ckpt.summary())
+			}
+		case opts.MultiDomain && os.IsNotExist(err):
+			// Domains the interrupted run never reached start from scratch
+		default:
+			fmt.Printf("[!] Cannot resume: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	assets = newAssetStore(opts.V6Prefix)
+	foundItems := sync.Map{}
+	var processedCount int64
+
+	// 1. WILDCARD DETECTION
+	// Deeper levels are fingerprinted on demand as workers reach them
+	samples := opts.WildcardSamples
+	if offlineMode {
+		samples = 0
+	}
+	wildcards := newWildcardCache(domain, samples, opts.Silent, opts.Limiter)
+	ckpt.restoreWildcards(wildcards)
+	if !offlineMode {
+		if !opts.Silent {
+			fmt.Println("[*] Detecting wildcard responses...")
+		}
+		wildcards.fingerprint(domain)
+	} else if !opts.Silent {
+		fmt.Println("[*] Offline mode enabled. Skipping wildcard detection.")
+	}
+
+	// 2. OUTPUT FILES
+	files := opts.SharedFiles
+	if opts.Combined == "" {
+		files = openOutputs(domain, opts.Formats, opts.Resume, false)
+		defer closeOutputs(files)
+	}
+	var jsonSinks []io.Writer
+	if f, ok := files["jsonl"]; ok {
+		jsonSinks = append(jsonSinks, f)
+	}
+	if opts.JSONLOut {
+		jsonSinks = append(jsonSinks, os.Stdout)
+	}
+	jsonOut = nil
+	if len(jsonSinks) > 0 {
+		jsonOut = newJSONWriter(domain, jsonSinks...)
+	}
+
+	// 3. START WORKERS
+	cfg := &scanConfig{
+		Domain:     domain,
+		Threads:    opts.Threads,
+		Delay:      opts.Delay,
+		Jitter:     opts.Jitter,
+		Limiter:    opts.Limiter,
+		FoundItems: &foundItems,
+		Counter:    &processedCount,
+		Files:      files,
+		URLOnly:    opts.URLOnly,
+		IPOnly:     opts.IPOnly,
+		Silent:     opts.Silent,
+		FilterCDN:  opts.FilterCDN,
+		Wildcards:  wildcards,
+		Checkpoint: ckpt,
+		Combined:   opts.Combined != "",
+	}
+	ckpt.restore(cfg)
+	stopAutosave := ckpt.autosave(opts.CheckpointInterval, opts.Silent, func() {
+		opts.Words.close()
+		opts.RecurseWords.close()
+	})
+	defer stopAutosave()
+
+	// 4. ZONE TRANSFER AGAINST AUTHORITATIVE NAMESERVERS
+	if opts.AXFR && !ckpt.completed("axfr") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] ZONE TRANSFER (AXFR/IXFR):\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		if !offlineMode {
+			if n := attemptZoneTransfer(cfg, domain, opts.AXFRPort); n > 0 && !opts.Silent {
+				fmt.Printf("[+] Registered %d host(s) from zone transfer\n", n)
+			}
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping zone transfer.")
+		}
+		ckpt.finishPhase("axfr")
+	}
+
+	// The domain's wordlist, also used to crack NSEC3 hashes
+	words := opts.Words.forDomain(domain)
+
+	// 5. DNSSEC ZONE WALKING (NSEC chain / NSEC3 hash cracking)
+	var walk *zoneWalk
+	if opts.DNSSEC && !ckpt.completed("dnssec") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] DNSSEC ZONE WALKING:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		if !offlineMode {
+			walk = walkZone(cfg, domain, words, opts.WalkMax)
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping DNSSEC zone walking.")
+		}
+		ckpt.finishPhase("dnssec")
+	}
+
+	// 6. WORDLIST BRUTE FORCE
+	scanStart := time.Now()
+	var found []scanJob
+	if ckpt.completed("wordlist") {
+		found = ckpt.found(domain, 1)
+	} else {
+		start := ckpt.position()
+		if start > 0 && !opts.Silent {
+			fmt.Printf("[*] Skipping %d wordlist entries processed before the interruption\n", start)
+		}
+		found = runScan(cfg, func(jobs chan<- scanJob) {
+			seq := 0
+			err := words.each(func(word string) bool {
+				if seq++; seq > start {
+					jobs <- scanJob{Target: word + "." + domain, Depth: 1, Seq: seq}
+				}
+				return true
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\r\033[K[!] Wordlist Error: %v\n", err)
+			}
+		})
+		ckpt.setWords(words.Words)
+		if !opts.Silent {
+			fmt.Printf("\r\033[K[*] Wordlist: %d unique word(s), %d duplicate(s) and %d invalid line(s) skipped\n", words.Words, words.Duplicates, words.Invalid)
+		}
+		// Hosts found before the interruption are recursion parents too
+		if start > 0 {
+			found = ckpt.found(domain, 1)
+		}
+		ckpt.finishPhase("wordlist")
+	}
+
+	// 6b. RECURSION: brute force below every host found on the previous level
+	if opts.Recursive && !ckpt.completed("recursion") {
+		levelWords := words
+		if opts.RecurseWords != nil {
+			levelWords = opts.RecurseWords.forDomain(domain)
+		}
+
+		for depth := 2; depth <= opts.MaxDepth && len(found) > 0; depth++ {
+			parents := found
+			if !opts.Silent {
+				fmt.Print("\r\033[K")
+				fmt.Printf("[*] Recursing into %d host(s) at depth %d\n", len(parents), depth)
+			}
+			found = runScan(cfg, func(jobs chan<- scanJob) {
+				for _, parent := range parents {
+					err := levelWords.each(func(word string) bool {
+						jobs <- scanJob{Target: word + "." + parent.Target, Depth: depth}
+						return true
+					})
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "\r\033[K[!] Recursion Wordlist Error: %v\n", err)
+						return
+					}
+				}
+			})
+		}
+		ckpt.finishPhase("recursion")
+	}
+
+	if !opts.Silent {
+		fmt.Print("\r\033[K")
+		fmt.Println("[*] Scan Complete. All workers have exited.")
+		if dnsEngine != nil {
+			elapsed := time.Since(scanStart)
+			fmt.Printf("[*] %d queries sent in %s (%.0f q/s)\n", dnsEngine.Sent(), elapsed.Round(time.Millisecond), float64(dnsEngine.Sent())/elapsed.Seconds())
+		}
+	}
+
+	// 7. SPF/TXT RECORD ANALYSIS FOR ORIGIN IP LEAKS
+	if !ckpt.completed("spf") {
+		if !offlineMode {
+			if !opts.Silent {
+				fmt.Println("[*] Checking SPF/TXT records for origin IP leaks...")
+			}
+			checkSPFLeaks(domain, opts.SPFLookups, opts.IPOnly, opts.Silent)
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping SPF/TXT checks.")
+		}
+		ckpt.finishPhase("spf")
+	}
+
+	// 7b. MAIL INFRASTRUCTURE (MX, DMARC, DKIM, BIMI, SMTP banners)
+	if opts.Mail && !ckpt.completed("mail") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] MAIL INFRASTRUCTURE:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		if !offlineMode {
+			analyzeMail(domain, opts.SMTPPort, opts.DKIMSelectors, opts.IPOnly, opts.Silent)
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping mail analysis.")
+		}
+		ckpt.finishPhase("mail")
+	}
+
+	// 8. CNAME CHASER LOGIC
+	if !ckpt.completed("cname") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] CNAME CHASER ANALYSIS:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		chaseHosts := []string{domain}
+		for _, s := range []string{"www", "dev", "api", "origin", "mail", "internal", "staging", "portal"} {
+			chaseHosts = append(chaseHosts, s+"."+domain)
+		}
+		for _, host := range assets.hostNames() {
+			if inZone(host, domain) && !slices.Contains(chaseHosts, host) {
+				chaseHosts = append(chaseHosts, host)
+			}
+		}
+		checkCNAMEChaser(cfg, chaseHosts, opts.IPOnly, opts.FilterCDN)
+		ckpt.finishPhase("cname")
+	}
+
+	// 9. PASSIVE SOURCES (certificate transparency and other providers)
+	var passive *sourceRun
+	if !ckpt.completed("passive") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] PASSIVE SOURCE DISCOVERY:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		sources := opts.Sources
+		if offlineMode {
+			// Only sources that read local data (e.g. -certs) can run offline
+			sources = offlineSources(sources)
+			if len(sources) == 0 && !opts.Silent {
+				fmt.Println("[*] Offline mode enabled. Skipping passive sources.")
+			}
+		}
+		if len(sources) > 0 {
+			passive = runSources(sources, domain, opts.SourceTimeout, opts.SourceTimeouts)
+			names := passive.sorted()
+			if len(names) > 0 {
+				if !opts.Silent {
+					fmt.Printf("[+] Found %d unique names from %d source(s)\n", len(names), len(sources))
+				}
+				for _, name := range names {
+					src := passive.Names[name]
+					if !inScope.AllowHost(name, src) {
+						continue
+					}
+					if resolveAndRegister(name, src) {
+						passive.stats(src).Resolved++
+					}
+				}
+				for ip, host := range passive.IPs {
+					if inScope.AllowIP(ip, passive.Names[host]) {
+						assets.addAddress(host, ip, passive.Names[host])
+					}
+				}
+				if !opts.Silent {
+					if len(passive.IPs) > 0 {
+						fmt.Printf("[+] Registered %d address(es) listed on certificates\n", len(passive.IPs))
+					}
+					passive.printCertSummary()
+				}
+			} else if !opts.Silent {
+				fmt.Println("[-] No passive source results")
+			}
+
+			// Wildcard certificates (*.legacy.example.com) point at subtrees worth brute forcing
+			var hints []string
+			for _, parent := range passive.hints() {
+				if inScope.AllowHost("*."+parent, "CT wildcard") {
+					hints = append(hints, parent)
+				}
+			}
+			if len(hints) > 0 {
+				if !opts.Silent {
+					fmt.Printf("[*] Brute forcing below %d wildcard certificate parent(s): %s\n", len(hints), strings.Join(hints, ", "))
+				}
+				runScan(cfg, func(jobs chan<- scanJob) {
+					for _, parent := range hints {
+						words.each(func(word string) bool {
+							target := word + "." + parent
+							jobs <- scanJob{Target: target, Depth: strings.Count(strings.TrimSuffix(target, "."+domain), ".") + 1, Source: "CT Wildcard"}
+							return true
+						})
+					}
+				})
+				if !opts.Silent {
+					fmt.Print("\r\033[K")
+				}
+			}
+		}
+		ckpt.finishPhase("passive")
+	}
+
+	// 9b. PERMUTATIONS OF DISCOVERED NAMES
+	if opts.Permute && !ckpt.completed("permute") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] PERMUTATION ANALYSIS:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		known := assets.hostNames()
+		candidates := generatePermutations(known, domain, words.head(opts.PermWords), opts.PermMax, opts.PermWords)
+		if n := walk.crackNSEC3(cfg, candidates); n > 0 && !opts.Silent {
+			fmt.Printf("[+] Matched %d NSEC3 hash(es) against permutations, %d remaining\n", n, walk.remaining())
+		}
+		if !opts.Silent {
+			fmt.Printf("[*] Resolving %d permutations of %d discovered host(s)\n", len(candidates), len(known))
+		}
+		runScan(cfg, func(jobs chan<- scanJob) {
+			for _, c := range candidates {
+				jobs <- scanJob{Target: c, Depth: strings.Count(strings.TrimSuffix(c, "."+domain), ".") + 1, Source: "Permutation"}
+			}
+		})
+		if !opts.Silent {
+			fmt.Print("\r\033[K")
+		}
+		ckpt.finishPhase("permute")
+	}
+
+	// 9c. SUBDOMAIN TAKEOVER CHECK
+	if opts.Takeover && !ckpt.completed("takeover") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] SUBDOMAIN TAKEOVER CHECK:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		if !offlineMode {
+			runTakeoverCheck(cfg, opts.Fingerprints, opts.TakeoverHTTP)
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping takeover checks.")
+		}
+		ckpt.finishPhase("takeover")
+	}
+
+	// 10. REVERSE DNS SWEEP OF UNIQUE-ORIGIN SUBNETS
+	// Runs before the analysis so the hosts it finds are part of it
+	if opts.PTR && !ckpt.completed("ptr") {
+		if !opts.Silent {
+			fmt.Printf("\n\033[1m\033[34m[*] REVERSE DNS SWEEP:\033[0m %s\n", domain)
+			fmt.Println(strings.Repeat("━", 40))
+		}
+		if !offlineMode {
+			runPTRSweep(cfg, uniqueOrigins(analyzeSubnets(opts.FilterCDN)), opts.PTRPrefix, ptrKeywords(domain, opts.PTRKeywordList))
+		} else if !opts.Silent {
+			fmt.Println("[*] Offline mode enabled. Skipping PTR sweep.")
+		}
+		ckpt.finishPhase("ptr")
+	}
+
+	// 11. INFRASTRUCTURE FINGERPRINTING (Subnet-Based Anomaly Detection)
+	if !opts.Silent {
+		fmt.Printf("\n\033[1m\033[34m[!] INFRASTRUCTURE ANALYSIS FOR: %s\033[0m\n", domain)
+		fmt.Println(strings.Repeat("━", 60))
+	}
+	for _, report := range analyzeSubnets(opts.FilterCDN) {
+		status := "\033[32m[UNIQUE ORIGIN]\033[0m"
+		if report.CDN != "" {
+			status = fmt.Sprintf("\033[31m[CDN: %s]\033[0m", report.CDN)
+		} else if report.Shared {
+			status = "\033[33m[SHARED INFRA]\033[0m"
+		}
+
+		if opts.IPOnly {
+			for _, ip := range report.IPs {
+				fmt.Println(ip)
+			}
+		} else if opts.URLOnly {
+			for _, ip := range report.IPs {
+				for _, domain := range assets.hostsOf(ip) {
+					fmt.Println(domain)
+				}
+			}
+		} else if !opts.Silent {
+			fmt.Printf("%-18s %s\n", report.CIDR, status)
+			for _, ip := range report.IPs {
+				fmt.Printf("  └── %-15s (%d subdomains) via %s\n", ip, assets.hostCount(ip), strings.Join(assets.sourcesOf(ip), ", "))
+			}
+			fmt.Println()
+		}
+	}
+
+	if !opts.Silent {
+		printSourceSummary(passive)
+	}
+	ckpt.finishPhase("done")
+	return ckpt
+}
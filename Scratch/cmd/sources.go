@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// SourceResult is one name reported by a passive source, with the certificate
+// it came from when the source is certificate based. When IP is set the result
+// is an address (e.g. an IP SAN) and Name is the host it belongs to.
+type SourceResult struct {
+	Name string
+	IP   string
+	Cert *CertInfo
+}
+
+// CertInfo is the certificate metadata kept for reporting
+type CertInfo struct {
+	ID        string
+	Issuer    string
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// expired reports whether the certificate was no longer valid at t
+func (c *CertInfo) expired(t time.Time) bool {
+	return !c.NotAfter.IsZero() && t.After(c.NotAfter)
+}
+
+// Source is a passive subdomain provider. Enumerate sends every name it finds
+// for domain on out and returns when done or when ctx expires; the caller owns out.
+type Source interface {
+	Name() string
+	Enumerate(ctx context.Context, domain string, out chan<- SourceResult) error
+}
+
+// localSource is a provider that reads local files instead of the network. It
+// only joins "all" when configured, and local sources are the only ones run in
+// -offline mode.
+type localSource interface {
+	Source
+	Configured() bool
+}
+
+// configurableSource is a provider that takes settings from the command line
+type configurableSource interface {
+	Source
+	configure(opts sourceOptions)
+}
+
+// sourceOptions are the provider settings main reads from its flags
+type sourceOptions struct {
+	CrtshURL  string // -crtsh-url
+	CertsPath string // -certs
+}
+
+// sourceRegistry holds every available provider. Each provider registers itself
+// from an init() in its own file; main passes the flag values to them through
+// configureSources.
+var sourceRegistry = make(map[string]Source)
+
+// configureSources hands opts to every registered provider that takes settings.
+// It runs before selectSources, which asks local sources whether they are Configured.
+func configureSources(opts sourceOptions) {
+	for _, src := range sourceRegistry {
+		if c, ok := src.(configurableSource); ok {
+			c.configure(opts)
+		}
+	}
+}
+
+// sendResults forwards results to out, stopping early if ctx expires
+func sendResults(ctx context.Context, out chan<- SourceResult, results []SourceResult) error {
+	for _, res := range results {
+		select {
+		case out <- res:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// registerSource makes a provider available to -sources
+func registerSource(s Source) {
+	sourceRegistry[s.Name()] = s
+}
+
+// sourceNames lists registered providers alphabetically
+func sourceNames() []string {
+	var names []string
+	for name := range sourceRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectSources resolves the -sources/-exclude-sources lists ("all" selects
+// every provider). Unknown names are an error so typos don't silently skip a source.
+func selectSources(include, exclude string) ([]Source, error) {
+	pick := make(map[string]bool)
+	for _, name := range splitList(include) {
+		if name == "all" {
+			for n, src := range sourceRegistry {
+				if local, ok := src.(localSource); !ok || local.Configured() {
+					pick[n] = true
+				}
+			}
+			continue
+		}
+		if _, ok := sourceRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(sourceNames(), ", "))
+		}
+		pick[name] = true
+	}
+	for _, name := range splitList(exclude) {
+		if _, ok := sourceRegistry[name]; !ok {
+			return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(sourceNames(), ", "))
+		}
+		delete(pick, name)
+	}
+
+	var sources []Source
+	for _, name := range sourceNames() {
+		if pick[name] {
+			sources = append(sources, sourceRegistry[name])
+		}
+	}
+	return sources, nil
+}
+
+// offlineSources keeps the providers that work without network access
+func offlineSources(sources []Source) []Source {
+	var local []Source
+	for _, src := range sources {
+		if _, ok := src.(localSource); ok {
+			local = append(local, src)
+		}
+	}
+	return local
+}
+
+// parseSourceTimeouts reads "name=duration" pairs overriding the default per-source timeout
+func parseSourceTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, pair := range splitList(spec) {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid source timeout %q (want name=duration)", pair)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source timeout %q: %v", pair, err)
+		}
+		timeouts[name] = d
+	}
+	return timeouts, nil
+}
+
+// splitList splits a comma-separated flag value, dropping blanks
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.ToLower(strings.TrimSpace(part)); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// normalizeName cleans a raw passive result and scopes it to domain. Wildcard
+// names ("*.dev.example.com") come back as their parent with wildcard set.
+// Emails, IP literals, invalid labels and out-of-scope names are rejected.
+func normalizeName(raw, domain string) (name string, wildcard bool, ok bool) {
+	name = strings.ToLower(strings.Trim(strings.TrimSpace(raw), "."))
+	if name == "" || strings.Contains(name, "@") || parseAddr(name) != nil {
+		return "", false, false
+	}
+	if strings.HasPrefix(name, "*.") {
+		name, wildcard = name[2:], true
+	}
+	if !inZone(name, domain) {
+		return "", false, false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !validLabel(label) {
+			return "", false, false
+		}
+	}
+	return name, wildcard, true
+}
+
+// validLabel accepts LDH labels plus underscores (_dmarc, _domainkey)
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range label {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceStats records how one provider did during a run
+type sourceStats struct {
+	Name     string
+	Results  int // names reported, including duplicates
+	Filtered int // rejected by normalization or scope
+	Unique   int // names no earlier source reported
+	Resolved int
+	Duration time.Duration
+	Err      error
+}
+
+// sourceRun is the merged output of every enabled provider
+type sourceRun struct {
+	Names map[string]string      // name -> first source that reported it
+	Hints map[string]bool        // parents of wildcard names, worth brute forcing below
+	Certs map[string][]*CertInfo // name -> certificates it appeared in
+	IPs   map[string]string      // address -> host it was reported for
+	Stats []*sourceStats
+}
+
+// runSources runs every provider concurrently, each under its own timeout, and
+// merges their names. A source that errors or times out keeps whatever it sent.
+func runSources(sources []Source, domain string, timeout time.Duration, overrides map[string]time.Duration) *sourceRun {
+	run := &sourceRun{Names: make(map[string]string), Hints: make(map[string]bool), Certs: make(map[string][]*CertInfo), IPs: make(map[string]string)}
+	domain = strings.ToLower(domain)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, src := range sources {
+		stats := &sourceStats{Name: src.Name()}
+		run.Stats = append(run.Stats, stats)
+
+		limit := timeout
+		if d, ok := overrides[src.Name()]; ok {
+			limit = d
+		}
+
+		wg.Add(1)
+		go func(src Source) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), limit)
+			defer cancel()
+
+			out := make(chan SourceResult)
+			done := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				done <- src.Enumerate(ctx, domain, out)
+				close(out)
+			}()
+
+			for res := range out {
+				name, wildcard, ok := normalizeName(res.Name, domain)
+				mu.Lock()
+				stats.Results++
+				if !ok {
+					stats.Filtered++
+					mu.Unlock()
+					continue
+				}
+				if res.IP != "" {
+					if parseAddr(res.IP) == nil || wildcard {
+						stats.Filtered++
+					} else if _, seen := run.IPs[res.IP]; !seen {
+						run.IPs[res.IP] = name
+						if _, known := run.Names[name]; !known {
+							run.Names[name] = src.Name()
+							stats.Unique++
+						}
+					}
+					mu.Unlock()
+					continue
+				}
+				if wildcard && name != domain {
+					run.Hints[name] = true
+				}
+				if _, seen := run.Names[name]; !seen {
+					run.Names[name] = src.Name()
+					stats.Unique++
+				}
+				if res.Cert != nil {
+					run.addCert(name, res.Cert)
+				}
+				mu.Unlock()
+			}
+			stats.Err = <-done
+			if stats.Err == nil && ctx.Err() != nil {
+				stats.Err = ctx.Err()
+			}
+			stats.Duration = time.Since(start)
+		}(src)
+	}
+	wg.Wait()
+	return run
+}
+
+// sorted returns the merged names alphabetically
+func (r *sourceRun) sorted() []string {
+	var names []string
+	for name := range r.Names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addCert records that name appeared in cert, once per certificate
+func (r *sourceRun) addCert(name string, cert *CertInfo) {
+	for _, c := range r.Certs[name] {
+		if c.ID == cert.ID {
+			return
+		}
+	}
+	r.Certs[name] = append(r.Certs[name], cert)
+}
+
+// hints returns the wildcard parents alphabetically
+func (r *sourceRun) hints() []string {
+	var hints []string
+	for h := range r.Hints {
+		hints = append(hints, h)
+	}
+	sort.Strings(hints)
+	return hints
+}
+
+// printCertSummary lists the issuers seen and how many names each covered,
+// along with the names only found on expired certificates
+func (r *sourceRun) printCertSummary() {
+	if len(r.Certs) == 0 {
+		return
+	}
+	issuers := make(map[string]map[string]bool)
+	var expiredOnly []string
+	now := time.Now()
+	for name, certs := range r.Certs {
+		live := false
+		for _, c := range certs {
+			if issuers[c.Issuer] == nil {
+				issuers[c.Issuer] = make(map[string]bool)
+			}
+			issuers[c.Issuer][name] = true
+			if !c.expired(now) {
+				live = true
+			}
+		}
+		if !live {
+			expiredOnly = append(expiredOnly, name)
+		}
+	}
+
+	var names []string
+	for issuer := range issuers {
+		names = append(names, issuer)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(issuers[names[i]]) > len(issuers[names[j]]) })
+	for _, issuer := range names {
+		fmt.Printf("  [cert] %-50s %d name(s)\n", issuer, len(issuers[issuer]))
+	}
+	if len(expiredOnly) > 0 {
+		sort.Strings(expiredOnly)
+		fmt.Printf("  [cert] %d name(s) only seen on expired certificates: %s\n", len(expiredOnly), strings.Join(expiredOnly, ", "))
+	}
+}
+
+// stats returns the entry for a provider by name
+func (r *sourceRun) stats(name string) *sourceStats {
+	for _, s := range r.Stats {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// printSourceSummary renders per-source result counts
+func printSourceSummary(run *sourceRun) {
+	if run == nil || len(run.Stats) == 0 {
+		return
+	}
+	fmt.Printf("\n\033[1m\033[34m[*] PASSIVE SOURCES:\033[0m\n")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  SOURCE\tRESULTS\tFILTERED\tUNIQUE\tRESOLVED\tTIME\tSTATUS")
+	for _, s := range run.Stats {
+		status := "\033[32mOK\033[0m"
+		switch {
+		case errors.Is(s.Err, context.DeadlineExceeded):
+			status = "\033[33mTIMEOUT\033[0m"
+		case s.Err != nil:
+			status = fmt.Sprintf("\033[31mERROR: %v\033[0m", s.Err)
+		}
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%d\t%d\t%s\t%s\n", s.Name, s.Results, s.Filtered, s.Unique, s.Resolved, s.Duration.Round(time.Millisecond), status)
+	}
+	w.Flush()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// spfEntry is an address or range a policy authorizes, with the chain of
+// domains (apex > include > ...) that led to it
+type spfEntry struct {
+	Value     string // IP or CIDR
+	Mechanism string // ip4, ip6, a, mx
+	Chain     []string
+}
+
+// provenance renders the include chain for asset sources and output
+func (e spfEntry) provenance() string {
+	return "SPF " + strings.Join(e.Chain, " > ")
+}
+
+// thirdParty reports whether the entry was reached through a name outside apex,
+// e.g. include:_spf.google.com: such ranges belong to the provider, not to apex
+func (e spfEntry) thirdParty(apex string) bool {
+	for _, name := range e.Chain {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if name != apex && !strings.HasSuffix(name, "."+apex) {
+			return true
+		}
+	}
+	return false
+}
+
+// spfEvaluator walks an SPF policy the way a receiver would, but collects
+// every authorized address instead of checking one
+type spfEvaluator struct {
+	maxLookups int
+	lookups    int
+	visited    map[string]bool
+	entries    []spfEntry
+	seen       map[string]bool
+	warnings   []string
+}
+
+// newSPFEvaluator returns an evaluator allowing maxLookups DNS-querying terms
+// (include, a, mx, ptr, exists, redirect); RFC 7208 sets this at 10
+func newSPFEvaluator(maxLookups int) *spfEvaluator {
+	return &spfEvaluator{maxLookups: maxLookups, visited: make(map[string]bool), seen: make(map[string]bool)}
+}
+
+func (e *spfEvaluator) warn(format string, args ...interface{}) {
+	e.warnings = append(e.warnings, fmt.Sprintf(format, args...))
+}
+
+// spend counts one DNS-querying term and reports whether the limit allows it
+func (e *spfEvaluator) spend(term string) bool {
+	if e.lookups >= e.maxLookups {
+		e.warn("lookup limit (%d) reached, skipped %s", e.maxLookups, term)
+		return false
+	}
+	e.lookups++
+	return true
+}
+
+// add records an address or range once, normalizing CIDRs to their network
+func (e *spfEvaluator) add(value, mechanism string, chain []string) {
+	if _, network, err := net.ParseCIDR(value); err == nil {
+		if ones, bits := network.Mask.Size(); ones == bits {
+			value = network.IP.String()
+		} else {
+			value = network.String()
+		}
+	} else if ip := net.ParseIP(value); ip != nil {
+		value = ip.String()
+	} else {
+		e.warn("invalid %s value %q in %s", mechanism, value, chain[len(chain)-1])
+		return
+	}
+	if e.seen[value] {
+		return
+	}
+	e.seen[value] = true
+	e.entries = append(e.entries, spfEntry{Value: value, Mechanism: mechanism, Chain: append([]string(nil), chain...)})
+}
+
+// fetchSPF returns the v=spf1 record published at domain
+func fetchSPF(domain string) (string, error) {
+	res, err := queryDNS(domain, dns.TypeTXT, getRandomResolver())
+	if err != nil {
+		return "", err
+	}
+	var records []string
+	for _, rec := range res.Answers {
+		if rec.Type != "TXT" {
+			continue
+		}
+		if v := strings.TrimSpace(rec.Value); strings.EqualFold(v, "v=spf1") || strings.HasPrefix(strings.ToLower(v), "v=spf1 ") {
+			records = append(records, v)
+		}
+	}
+	switch len(records) {
+	case 0:
+		return "", fmt.Errorf("no SPF record")
+	case 1:
+		return records[0], nil
+	default:
+		return records[0], fmt.Errorf("%d SPF records published, using the first", len(records))
+	}
+}
+
+// evaluate processes the policy at domain; chain is the path that led here
+func (e *spfEvaluator) evaluate(domain string, chain []string) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	parents := chain
+	chain = append(chain, domain)
+	if e.visited[domain] {
+		if slices.Contains(parents, domain) {
+			e.warn("include loop: %s", strings.Join(chain, " > "))
+		} else {
+			e.warn("%s included more than once", domain)
+		}
+		return
+	}
+	e.visited[domain] = true
+
+	record, err := fetchSPF(domain)
+	if record == "" {
+		e.warn("%s: %v", domain, err)
+		return
+	}
+	if err != nil {
+		e.warn("%s: %v", domain, err)
+	}
+
+	redirect := ""
+	hasAll := false
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+		if strings.HasPrefix(lower, "redirect=") {
+			redirect = term[len("redirect="):]
+			continue
+		}
+		if strings.HasPrefix(lower, "exp=") {
+			continue
+		}
+
+		qualifier := "+"
+		if strings.ContainsAny(term[:1], "+-~?") {
+			qualifier, term = term[:1], term[1:]
+		}
+		if strings.Contains(term, "%{") {
+			e.warn("macro not expanded: %s", term)
+			continue
+		}
+
+		name, arg, _ := strings.Cut(term, ":")
+		name, cidr := splitSPFCIDR(strings.ToLower(name))
+		if arg != "" {
+			arg, cidr = splitSPFCIDR(arg)
+		}
+
+		switch name {
+		case "all":
+			hasAll = true
+		case "ip4", "ip6":
+			// -ip4 lists addresses the domain refuses, not ones it sends from
+			if qualifier != "-" {
+				e.add(arg+cidr, name, chain)
+			}
+		case "include":
+			if e.spend(term) {
+				e.evaluate(arg, chain)
+			}
+		case "a", "mx":
+			if !e.spend(term) || qualifier == "-" {
+				continue
+			}
+			target := domain
+			if arg != "" {
+				target = arg
+			}
+			hosts := []string{target}
+			if name == "mx" {
+				hosts = lookupMXHosts(target)
+			}
+			for _, host := range hosts {
+				res, err := lookupHost(host, getRandomResolver())
+				if err != nil || !res.Exists() {
+					e.warn("%s: %s does not resolve", term, host)
+					continue
+				}
+				for _, ip := range res.IPs() {
+					e.add(applySPFCIDR(ip, cidr), name, append(chain, host))
+				}
+			}
+		case "ptr", "exists":
+			e.spend(term)
+		default:
+			e.warn("unknown term %q in %s", term, domain)
+		}
+	}
+
+	if redirect != "" && !hasAll && e.spend("redirect="+redirect) {
+		e.evaluate(redirect, chain)
+	}
+}
+
+// splitSPFCIDR separates "host/24//64" into the host and the raw prefix suffix
+func splitSPFCIDR(s string) (string, string) {
+	if idx := strings.Index(s, "/"); idx != -1 {
+		return s[:idx], s[idx:]
+	}
+	return s, ""
+}
+
+// applySPFCIDR widens a resolved address by an a/mx prefix ("/24", "//64" or "/24//64")
+func applySPFCIDR(ip, cidr string) string {
+	if cidr == "" {
+		return ip
+	}
+	v4, v6, _ := strings.Cut(strings.TrimPrefix(cidr, "/"), "//")
+	if strings.HasPrefix(cidr, "//") {
+		v4, v6 = "", strings.TrimPrefix(cidr, "//")
+	}
+	prefix := v4
+	if strings.Contains(ip, ":") {
+		prefix = v6
+	}
+	if _, err := strconv.Atoi(prefix); prefix == "" || err != nil {
+		return ip
+	}
+	return ip + "/" + prefix
+}
+
+// lookupMXHosts returns the exchange hosts for domain (at most 10, per RFC 7208)
+func lookupMXHosts(domain string) []string {
+	res, err := queryDNS(domain, dns.TypeMX, getRandomResolver())
+	if err != nil {
+		return nil
+	}
+	var hosts []string
+	for _, rec := range res.Answers {
+		if rec.Type == "MX" && rec.Value != "" && len(hosts) < 10 {
+			hosts = append(hosts, rec.Value)
+		}
+	}
+	return hosts
+}
+
+// checkSPFLeaks evaluates the domain's SPF policy recursively and registers
+// every authorized address or range of the domain's own with its include chain
+// as provenance; ranges reached through third-party includes are only listed
+func checkSPFLeaks(domain string, maxLookups int, ipOnly, silent bool) {
+	e := newSPFEvaluator(maxLookups)
+	e.evaluate(domain, nil)
+
+	if !silent && len(e.entries) > 0 {
+		fmt.Printf("[*] SPF policy for %s authorizes %d address(es)/range(s) (%d/%d DNS lookups)\n", domain, len(e.entries), e.lookups, e.maxLookups)
+	}
+	for _, entry := range e.entries {
+		if !inScope.AllowIP(entry.Value, "SPF") {
+			continue
+		}
+		tag := "SPF " + entry.Mechanism
+		if entry.thirdParty(domain) {
+			// A provider's shared ranges say nothing about the domain's own
+			// servers, so they stay out of the infrastructure analysis and PTR sweep
+			tag += ", third-party"
+		} else {
+			assets.addAddress(domain, entry.Value, entry.provenance())
+			if ipOnly {
+				fmt.Println(entry.Value)
+			}
+		}
+
+		if !ipOnly && !silent {
+			fmt.Printf("%-24s [\033[33m%s\033[0m] %s\n", entry.Value, tag, strings.Join(entry.Chain, " > "))
+		}
+	}
+	if !silent {
+		for _, w := range e.warnings {
+			fmt.Printf("[!] SPF: %s\n", w)
+		}
+	}
+}
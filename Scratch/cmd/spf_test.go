@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// serveZone answers queries from a zone file on a local UDP port and makes it
+// the only resolver until the test ends
+func serveZone(t *testing.T, path, origin string) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records := make(map[string][]dns.RR)
+	parser := dns.NewZoneParser(file, dns.Fqdn(origin), path)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		name := strings.ToLower(rr.Header().Name)
+		records[name] = append(records[name], rr)
+	}
+	if err := parser.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		q := req.Question[0]
+		rrs, ok := records[strings.ToLower(q.Name)]
+		if !ok {
+			m.Rcode = dns.RcodeNameError
+		}
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		w.WriteMsg(m)
+	})}
+	go server.ActivateAndServe()
+
+	saved, savedOffline, savedHosts := resolverNames, offlineMode, localHosts
+	resolverNames = map[string]string{pc.LocalAddr().String(): "mock"}
+	offlineMode, localHosts = false, nil
+	t.Cleanup(func() {
+		server.Shutdown()
+		resolverNames, offlineMode, localHosts = saved, savedOffline, savedHosts
+	})
+}
+
+func spfValues(e *spfEvaluator) []string {
+	var values []string
+	for _, entry := range e.entries {
+		values = append(values, entry.Value)
+	}
+	return values
+}
+
+func hasWarning(e *spfEvaluator, substr string) bool {
+	return slices.ContainsFunc(e.warnings, func(w string) bool { return strings.Contains(w, substr) })
+}
+
+func TestSPFEvaluator(t *testing.T) {
+	serveZone(t, "../../testenv/records-local.txt", "local.test")
+
+	tests := []struct {
+		name       string
+		maxLookups int
+		want       []string // entries, in evaluation order
+		lookups    int
+		warnings   []string
+	}{
+		{
+			name:       "full policy",
+			maxLookups: 10,
+			want:       []string{"192.0.2.10", "198.51.100.0/28", "2001:db8:cafe::/48", "192.0.2.32/30", "192.0.2.25", "127.0.0.1"},
+			lookups:    7,
+			warnings:   []string{"include loop: local.test > _spf.local.test > _spf2.local.test > _spf.local.test", "aspmx.l.google.com does not resolve"},
+		},
+		{
+			name:       "lookup limit",
+			maxLookups: 2,
+			want:       []string{"192.0.2.10", "198.51.100.0/28", "2001:db8:cafe::/48"},
+			lookups:    2,
+			warnings:   []string{"lookup limit (2) reached, skipped include:_spf.local.test", "lookup limit (2) reached, skipped redirect=_spf3.local.test"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newSPFEvaluator(tt.maxLookups)
+			e.evaluate("local.test", nil)
+			if got := spfValues(e); !slices.Equal(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			if e.lookups != tt.lookups {
+				t.Errorf("lookups = %d, want %d", e.lookups, tt.lookups)
+			}
+			for _, w := range tt.warnings {
+				if !hasWarning(e, w) {
+					t.Errorf("missing warning %q in %q", w, e.warnings)
+				}
+			}
+			// -ip4 lists an address the domain refuses
+			if slices.Contains(spfValues(e), "203.0.113.99") {
+				t.Error("-ip4 address collected")
+			}
+		})
+	}
+}
+
+func TestSPFRedirectChain(t *testing.T) {
+	serveZone(t, "../../testenv/records-local.txt", "local.test")
+
+	e := newSPFEvaluator(10)
+	e.evaluate("local.test", nil)
+	for _, entry := range e.entries {
+		if entry.Value != "192.0.2.32/30" {
+			continue
+		}
+		want := []string{"local.test", "_spf.local.test", "_spf2.local.test", "_spf3.local.test", "relay.local.test"}
+		if !slices.Equal(entry.Chain, want) || entry.Mechanism != "a" {
+			t.Errorf("redirected a/30 entry = %+v, want chain %v", entry, want)
+		}
+		return
+	}
+	t.Error("range reached through redirect= not collected")
+}
+
+func TestSPFEntryThirdParty(t *testing.T) {
+	tests := []struct {
+		chain []string
+		want  bool
+	}{
+		{[]string{"example.com"}, false},
+		{[]string{"example.com", "_spf.example.com"}, false},
+		{[]string{"example.com", "_spf.example.com", "relay.example.com."}, false},
+		{[]string{"example.com", "_spf.google.com"}, true},
+		{[]string{"example.com", "aspmx.l.google.com"}, true},
+		{[]string{"example.com", "notexample.com"}, true},
+	}
+	for _, tt := range tests {
+		if got := (spfEntry{Chain: tt.chain}).thirdParty("example.com"); got != tt.want {
+			t.Errorf("thirdParty(%v) = %v, want %v", tt.chain, got, tt.want)
+		}
+	}
+}
+
+func TestApplySPFCIDR(t *testing.T) {
+	tests := []struct {
+		ip, cidr, want string
+	}{
+		{"192.0.2.33", "", "192.0.2.33"},
+		{"192.0.2.33", "/30", "192.0.2.33/30"},
+		{"2001:db8::1", "/24//64", "2001:db8::1/64"},
+		{"2001:db8::1", "//48", "2001:db8::1/48"},
+		{"192.0.2.33", "//48", "192.0.2.33"},
+	}
+	for _, tt := range tests {
+		if got := applySPFCIDR(tt.ip, tt.cidr); got != tt.want {
+			t.Errorf("applySPFCIDR(%q, %q) = %q, want %q", tt.ip, tt.cidr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultFingerprints is the built-in takeover fingerprint list; -fingerprints replaces it
+//
+//go:embed takeovers.json
+var defaultFingerprints []byte
+
+// takeoverFingerprint describes how an unclaimed resource looks on one service
+type takeoverFingerprint struct {
+	Service      string   `json:"service"`
+	CNAME        []string `json:"cname"`                  // suffixes of the CNAME targets the service hands out
+	Fingerprints []string `json:"fingerprints,omitempty"` // body snippets of the "not claimed" page
+	Status       int      `json:"status,omitempty"`       // expected status code of that page (0 = any)
+	NXDomain     bool     `json:"nxdomain,omitempty"`     // a target that doesn't resolve can be registered
+}
+
+// loadFingerprints reads a fingerprint file, or the built-in list when path is empty
+func loadFingerprints(path string) ([]takeoverFingerprint, error) {
+	data := defaultFingerprints
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	var fps []takeoverFingerprint
+	if err := json.Unmarshal(data, &fps); err != nil {
+		return nil, fmt.Errorf("invalid fingerprint file: %v", err)
+	}
+	for i, fp := range fps {
+		if fp.Service == "" || len(fp.CNAME) == 0 {
+			return nil, fmt.Errorf("fingerprint %d needs a service and at least one cname", i+1)
+		}
+	}
+	return fps, nil
+}
+
+// matchFingerprint returns the service any hop of chain belongs to
+func matchFingerprint(fps []takeoverFingerprint, chain []string) *takeoverFingerprint {
+	for _, hop := range chain {
+		for i := range fps {
+			for _, suffix := range fps[i].CNAME {
+				if inZone(hop, strings.ToLower(suffix)) {
+					return &fps[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// cnameEntry is a host seen answering with a CNAME chain during the scan
+type cnameEntry struct {
+	Chain    []string
+	IPs      []string
+	Dangling bool // the chain ends in a name that answered NXDOMAIN
+	Unknown  bool // the final lookup failed (SERVFAIL, REFUSED, ...), so liveness is unknown
+}
+
+// trackCNAME remembers target's CNAME chain, including chains whose final
+// target is NXDOMAIN, so the takeover check can revisit them. Only NXDOMAIN
+// counts as dangling; other failures stay unknown until a later lookup answers.
+func trackCNAME(target string, res *DNSResult, source string) {
+	chain := res.CNAMEChain()
+	if len(chain) == 0 {
+		return
+	}
+	assets.addAliases(target, chain, source)
+	assets.trackAlias(target, &cnameEntry{
+		Chain:    chain,
+		IPs:      res.IPs(),
+		Dangling: res.Rcode == dns.RcodeNameError,
+		Unknown:  res.Rcode != dns.RcodeSuccess && res.Rcode != dns.RcodeNameError,
+	})
+}
+
+// takeoverFinding is a host whose CNAME leads to a resource someone else could claim
+type takeoverFinding struct {
+	Host       string
+	Chain      []string
+	Service    string
+	Reason     string
+	Confidence string // VULNERABLE when a fingerprint matched, POTENTIAL otherwise
+}
+
+// fetchUnclaimedPage requests scheme://host[:port]/ from ip directly, with host as
+// the Host header and SNI, and returns the status and the start of the body.
+// endpoint is "http", "https" or either with a port ("http:8080").
+func fetchUnclaimedPage(host, ip, endpoint string) (int, string, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				_, port, _ := net.SplitHostPort(addr)
+				return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			},
+			// Unclaimed pages are usually served with the provider's certificate
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: host},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	scheme, port, _ := strings.Cut(endpoint, ":")
+	target := host
+	if port != "" {
+		target = net.JoinHostPort(host, port)
+	}
+	resp, err := client.Get(scheme + "://" + target + "/")
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 512*1024))
+	return resp.StatusCode, string(body), err
+}
+
+// endpointPort returns the port a takeover endpoint connects to
+func endpointPort(endpoint string) int {
+	scheme, port, _ := strings.Cut(endpoint, ":")
+	if n, err := strconv.Atoi(port); err == nil {
+		return n
+	}
+	if scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// checkTakeover classifies one host. Dangling chains are reported outright;
+// chains that still resolve need a matching "unclaimed" page on HTTP or HTTPS.
+func checkTakeover(fps []takeoverFingerprint, host string, entry *cnameEntry, domain string, endpoints []string) *takeoverFinding {
+	target := entry.Chain[len(entry.Chain)-1]
+	fp := matchFingerprint(fps, entry.Chain)
+	finding := &takeoverFinding{Host: host, Chain: entry.Chain}
+
+	// A flaky resolver says nothing about whether the target exists
+	if entry.Unknown {
+		return nil
+	}
+	if entry.Dangling {
+		// A dangling alias back into our own zone is a stale record, not a takeover
+		if inZone(target, domain) {
+			return nil
+		}
+		finding.Reason = fmt.Sprintf("CNAME target %s is NXDOMAIN", target)
+		finding.Confidence = "POTENTIAL"
+		finding.Service = "unknown service"
+		if fp != nil {
+			finding.Service = fp.Service
+			if fp.NXDomain {
+				finding.Confidence = "VULNERABLE"
+			}
+		}
+		return finding
+	}
+
+	if fp == nil || len(fp.Fingerprints) == 0 || len(entry.IPs) == 0 {
+		return nil
+	}
+	if !inScope.AllowHost(host, "takeover HTTP") || !inScope.AllowIP(entry.IPs[0], "takeover HTTP") {
+		return nil
+	}
+	for _, endpoint := range endpoints {
+		if !inScope.AllowPort(endpointPort(endpoint), "takeover HTTP") {
+			continue
+		}
+		status, body, err := fetchUnclaimedPage(host, entry.IPs[0], endpoint)
+		if err != nil || (fp.Status != 0 && status != fp.Status) {
+			continue
+		}
+		for _, snippet := range fp.Fingerprints {
+			if strings.Contains(body, snippet) {
+				finding.Service = fp.Service
+				finding.Reason = fmt.Sprintf("%s answered %d with %q", endpoint, status, snippet)
+				finding.Confidence = "VULNERABLE"
+				return finding
+			}
+		}
+	}
+	return nil
+}
+
+// runTakeoverCheck revisits every in-scope CNAME seen during the scan and
+// prints the hosts that point at unclaimed third-party resources
+func runTakeoverCheck(cfg *scanConfig, fps []takeoverFingerprint, endpoints []string) []*takeoverFinding {
+	var hosts []string
+	for _, host := range assets.aliasedHosts() {
+		if inZone(host, cfg.Domain) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	if !cfg.Silent {
+		fmt.Printf("[*] Checking %d CNAME(s) against %d service fingerprint(s)\n", len(hosts), len(fps))
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var findings []*takeoverFinding
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range jobs {
+				if f := checkTakeover(fps, host, assets.aliasOf(host), cfg.Domain, endpoints); f != nil {
+					mu.Lock()
+					findings = append(findings, f)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, host := range hosts {
+		jobs <- host
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Host < findings[j].Host })
+	for _, f := range findings {
+		jsonOut.takeover(f)
+	}
+	if cfg.Silent {
+		return findings
+	}
+	for _, f := range findings {
+		color := "\033[33m"
+		if f.Confidence == "VULNERABLE" {
+			color = "\033[1m\033[31m"
+		}
+		fmt.Printf("%s[%s]\033[0m %s (%s)\n", color, f.Confidence, f.Host, f.Service)
+		fmt.Printf("  └── %s -> %s\n", f.Host, strings.Join(f.Chain, " -> "))
+		fmt.Printf("  └── %s\n", f.Reason)
+	}
+	if len(findings) == 0 {
+		fmt.Println("[-] No takeover candidates found")
+	}
+	return findings
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func aliasResult(name string, rcode int, target string) *DNSResult {
+	return &DNSResult{
+		Name:    name,
+		Rcode:   rcode,
+		Answers: []DNSRecord{{Name: name, Type: "CNAME", Value: target}},
+	}
+}
+
+func TestTrackCNAMEServfailIsNotDangling(t *testing.T) {
+	assets = newAssetStore(64)
+	fps := []takeoverFingerprint{{Service: "Azure", CNAME: []string{"azurewebsites.net"}, NXDomain: true}}
+
+	trackCNAME("flaky.example.com", aliasResult("flaky.example.com", dns.RcodeServerFailure, "flaky.azurewebsites.net"), "Wordlist")
+	entry := assets.aliasOf("flaky.example.com")
+	if entry == nil || entry.Dangling || !entry.Unknown {
+		t.Fatalf("SERVFAIL target should be unknown, got %+v", entry)
+	}
+	if f := checkTakeover(fps, "flaky.example.com", entry, "example.com", nil); f != nil {
+		t.Errorf("SERVFAIL target reported as takeover: %+v", f)
+	}
+
+	// A later NXDOMAIN answer settles it
+	trackCNAME("flaky.example.com", aliasResult("flaky.example.com", dns.RcodeNameError, "flaky.azurewebsites.net"), "Wordlist")
+	entry = assets.aliasOf("flaky.example.com")
+	if !entry.Dangling || entry.Unknown {
+		t.Fatalf("NXDOMAIN target should be dangling, got %+v", entry)
+	}
+	if f := checkTakeover(fps, "flaky.example.com", entry, "example.com", nil); f == nil || f.Confidence != "VULNERABLE" {
+		t.Errorf("NXDOMAIN target not reported, got %+v", f)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadDomains reads the apex domains for -dL, one per line. Blank lines and
+// comments are skipped, duplicates dropped and invalid names rejected.
+func loadDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var domains []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domain := strings.TrimPrefix(strings.Trim(line, "."), "*.")
+		for _, label := range strings.Split(domain, ".") {
+			if !validLabel(label) {
+				return nil, fmt.Errorf("%s:%d: invalid domain %q", path, n, line)
+			}
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, scanner.Err()
+}
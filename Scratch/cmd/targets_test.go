@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadDomains(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []string
+		err  string
+	}{
+		{"normalized", "# targets\nExample.com\n\n  *.example.org.  \nlocal.test\n", []string{"example.com", "example.org", "local.test"}, ""},
+		{"duplicates", "example.com\nEXAMPLE.COM\nexample.com.\n", []string{"example.com"}, ""},
+		{"comments only", "# nothing yet\n\n", nil, ""},
+		{"invalid", "example.com\nbad domain.com\n", nil, ":2: invalid domain"},
+		{"empty label", "example..com\n", nil, ":1: invalid domain"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "domains.txt")
+		if err := os.WriteFile(path, []byte(tt.list), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadDomains(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: domains = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadDomainsMissingFile(t *testing.T) {
+	if _, err := loadDomains(filepath.Join(t.TempDir(), "missing.txt")); !os.IsNotExist(err) {
+		t.Errorf("error = %v, want not-exist", err)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Resolver transports. Plain "ip:port" entries are UDP; the others carry a scheme:
+// tcp://ip:port, tls://host:853 (DoT) and https://host/dns-query (DoH).
+const (
+	transportUDP = "udp"
+	transportTCP = "tcp"
+	transportDoT = "dot"
+	transportDoH = "doh"
+)
+
+// tlsInsecure skips certificate checks for DoT/DoH (self-signed test resolvers)
+var tlsInsecure bool
+
+// resolverTransport returns the transport a resolver entry uses
+func resolverTransport(resolver string) string {
+	switch {
+	case strings.HasPrefix(resolver, "https://"):
+		return transportDoH
+	case strings.HasPrefix(resolver, "tls://"):
+		return transportDoT
+	case strings.HasPrefix(resolver, "tcp://"):
+		return transportTCP
+	default:
+		return transportUDP
+	}
+}
+
+// connPool keeps idle TCP/DoT connections per resolver so queries reuse them
+type connPool struct {
+	mu    sync.Mutex
+	idle  map[string][]*dns.Conn
+	limit int
+}
+
+var streamConns = &connPool{idle: make(map[string][]*dns.Conn), limit: 16}
+
+// get returns an idle connection to resolver, or dials a new one
+func (p *connPool) get(resolver string) (*dns.Conn, error) {
+	p.mu.Lock()
+	if conns := p.idle[resolver]; len(conns) > 0 {
+		conn := conns[len(conns)-1]
+		p.idle[resolver] = conns[:len(conns)-1]
+		p.mu.Unlock()
+		return conn, nil
+	}
+	p.mu.Unlock()
+
+	transport := resolverTransport(resolver)
+	addr := strings.TrimPrefix(strings.TrimPrefix(resolver, "tcp://"), "tls://")
+	dialer := &net.Dialer{Timeout: dnsTimeout}
+
+	if transport == transportDoT {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host, InsecureSkipVerify: tlsInsecure})
+		if err != nil {
+			return nil, err
+		}
+		return &dns.Conn{Conn: conn}, nil
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &dns.Conn{Conn: conn}, nil
+}
+
+// put returns a healthy connection for reuse, closing it if the pool is full
+func (p *connPool) put(resolver string, conn *dns.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.idle[resolver]) >= p.limit {
+		conn.Close()
+		return
+	}
+	p.idle[resolver] = append(p.idle[resolver], conn)
+}
+
+// closeAll drops every idle connection
+func (p *connPool) closeAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for resolver, conns := range p.idle {
+		for _, c := range conns {
+			c.Close()
+		}
+		delete(p.idle, resolver)
+	}
+}
+
+// exchangeStream sends m over a pooled TCP or DoT connection. A stale pooled
+// connection (closed by the server while idle) is retried once on a fresh one.
+func exchangeStream(m *dns.Msg, resolver string) (*dns.Msg, time.Duration, error) {
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		conn, err := streamConns.get(resolver)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		start := time.Now()
+		conn.SetDeadline(start.Add(dnsTimeout))
+		if err = conn.WriteMsg(m); err == nil {
+			var resp *dns.Msg
+			if resp, err = conn.ReadMsg(); err == nil && resp.Id == m.Id {
+				streamConns.put(resolver, conn)
+				return resp, time.Since(start), nil
+			}
+			if err == nil {
+				err = fmt.Errorf("mismatched response id %d", resp.Id)
+			}
+		}
+		conn.Close()
+		lastErr = err
+	}
+	return nil, 0, lastErr
+}
+
+// dohClient is shared so HTTP keep-alive (and HTTP/2 where offered) reuses connections
+var dohClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost: 64,
+		IdleConnTimeout:     90 * time.Second,
+		ForceAttemptHTTP2:   true,
+		TLSClientConfig:     &tls.Config{},
+	},
+}
+
+// configureTransports applies the query timeout and TLS settings to the shared clients
+func configureTransports() {
+	dohClient.Timeout = dnsTimeout
+	dohClient.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify = tlsInsecure
+}
+
+// exchangeDoH POSTs m in RFC 8484 wire format to a DoH endpoint
+func exchangeDoH(m *dns.Msg, resolver string) (*dns.Msg, time.Duration, error) {
+	// RFC 8484 asks for ID 0 so responses are cache friendly
+	id := m.Id
+	m.Id = 0
+	packed, err := m.Pack()
+	m.Id = id
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", resolver, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	start := time.Now()
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		io.Copy(io.Discard, resp.Body)
+		return nil, 0, fmt.Errorf("DoH status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out := new(dns.Msg)
+	if err := out.Unpack(body); err != nil {
+		return nil, 0, err
+	}
+	out.Id = id
+	return out, time.Since(start), nil
+}
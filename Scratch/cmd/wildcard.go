@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// wildcardFingerprint is what a zone level answers for names that don't exist
+type wildcardFingerprint struct {
+	Zone     string
+	IPs      map[string]bool
+	CNAMEs   map[string]bool
+	Rotating bool // samples came back with different IP sets
+}
+
+// active reports whether the level answered for random labels at all
+func (f *wildcardFingerprint) active() bool {
+	return len(f.IPs) > 0 || len(f.CNAMEs) > 0
+}
+
+// wildcardEntry lets concurrent workers wait on a single fingerprinting run per level
+type wildcardEntry struct {
+	ready chan struct{}
+	fp    *wildcardFingerprint
+}
+
+// wildcardCache fingerprints every parent label under the apex once, on demand
+type wildcardCache struct {
+	apex    string
+	samples int
+	silent  bool
+	limiter <-chan struct{} // shared -qps bucket, nil = unlimited
+	mu      sync.Mutex
+	zones   map[string]*wildcardEntry
+}
+
+// newWildcardCache returns a cache for apex; samples <= 0 disables detection.
+// Every sample waits on limiter like a brute force query.
+func newWildcardCache(apex string, samples int, silent bool, limiter <-chan struct{}) *wildcardCache {
+	return &wildcardCache{
+		apex:    strings.ToLower(apex),
+		samples: samples,
+		silent:  silent,
+		limiter: limiter,
+		zones:   make(map[string]*wildcardEntry),
+	}
+}
+
+// fingerprint returns the cached fingerprint for zone, building it on first use
+func (c *wildcardCache) fingerprint(zone string) *wildcardFingerprint {
+	c.mu.Lock()
+	entry, ok := c.zones[zone]
+	if !ok {
+		entry = &wildcardEntry{ready: make(chan struct{})}
+		c.zones[zone] = entry
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-entry.ready
+		return entry.fp
+	}
+
+	entry.fp = c.sample(zone)
+	close(entry.ready)
+
+	if entry.fp.active() && !c.silent {
+		fmt.Print("\r\033[K")
+		fmt.Printf("\033[33m[+] Wildcard at *.%s:\033[0m %s\n", zone, entry.fp.describe())
+	}
+	return entry.fp
+}
+
+// sample resolves several random labels under zone through the scan resolvers
+func (c *wildcardCache) sample(zone string) *wildcardFingerprint {
+	fp := &wildcardFingerprint{Zone: zone, IPs: make(map[string]bool), CNAMEs: make(map[string]bool)}
+	var firstSet string
+
+	for i := 0; i < c.samples; i++ {
+		probe := fmt.Sprintf("%s.%s", randomLabel(12), zone)
+		if c.limiter != nil {
+			<-c.limiter
+		}
+		res, err := lookupHost(probe, getRandomResolver())
+		if err != nil || !res.Exists() {
+			continue
+		}
+
+		ips := res.IPs()
+		for _, ip := range ips {
+			fp.IPs[ip] = true
+		}
+		for _, cname := range res.CNAMEChain() {
+			fp.CNAMEs[cname] = true
+		}
+
+		sort.Strings(ips)
+		set := strings.Join(ips, ",")
+		if firstSet == "" {
+			firstSet = set
+		} else if set != firstSet {
+			fp.Rotating = true
+		}
+	}
+	return fp
+}
+
+// snapshot returns the fingerprints built so far, by zone
+func (c *wildcardCache) snapshot() map[string]*wildcardFingerprint {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fps := make(map[string]*wildcardFingerprint)
+	for zone, entry := range c.zones {
+		select {
+		case <-entry.ready:
+			fps[zone] = entry.fp
+		default:
+		}
+	}
+	return fps
+}
+
+// restore seeds the cache with fingerprints from an earlier run
+func (c *wildcardCache) restore(fps map[string]*wildcardFingerprint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for zone, fp := range fps {
+		entry := &wildcardEntry{ready: make(chan struct{}), fp: fp}
+		close(entry.ready)
+		c.zones[zone] = entry
+	}
+}
+
+// matches reports whether res for target looks like a wildcard answer from
+// any zone level between target's parent and the apex
+func (c *wildcardCache) matches(target string, res *DNSResult) bool {
+	if c == nil || c.samples <= 0 {
+		return false
+	}
+	for _, zone := range c.parentZones(target) {
+		if fp := c.fingerprint(zone); fp.active() && fp.covers(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownIP reports whether ip belongs to any wildcard pool seen so far
+func (c *wildcardCache) knownIP(ip string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.zones {
+		select {
+		case <-entry.ready:
+			if entry.fp.IPs[ip] {
+				return true
+			}
+		default:
+		}
+	}
+	return false
+}
+
+// parentZones lists target's ancestors down to and including the apex, nearest first
+func (c *wildcardCache) parentZones(target string) []string {
+	target = strings.ToLower(strings.TrimSuffix(target, "."))
+	if !strings.HasSuffix(target, "."+c.apex) {
+		return nil
+	}
+	var zones []string
+	for zone := target; zone != c.apex; {
+		idx := strings.Index(zone, ".")
+		if idx == -1 {
+			break
+		}
+		zone = zone[idx+1:]
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+// covers checks an answer against the fingerprint. A CNAME into the wildcard
+// target or an IP set inside the pool is a match; for rotating pools any
+// overlap counts, since a handful of samples never sees the whole pool.
+func (f *wildcardFingerprint) covers(res *DNSResult) bool {
+	for _, cname := range res.CNAMEChain() {
+		if f.CNAMEs[cname] {
+			return true
+		}
+	}
+
+	ips := res.IPs()
+	if len(ips) == 0 || len(f.IPs) == 0 {
+		return false
+	}
+	inPool := 0
+	for _, ip := range ips {
+		if f.IPs[ip] {
+			inPool++
+		}
+	}
+	return inPool == len(ips) || (f.Rotating && inPool > 0)
+}
+
+// describe renders the fingerprint for console output
+func (f *wildcardFingerprint) describe() string {
+	var parts []string
+	if len(f.IPs) > 0 {
+		parts = append(parts, strings.Join(getMapKeys(f.IPs), ", "))
+	}
+	if len(f.CNAMEs) > 0 {
+		parts = append(parts, "CNAME "+strings.Join(getMapKeys(f.CNAMEs), ", "))
+	}
+	if f.Rotating {
+		parts = append(parts, "(rotating)")
+	}
+	return strings.Join(parts, " ")
+}
+
+// randomLabel returns a lowercase alphanumeric label unlikely to exist
+func randomLabel(n int) string {
+	const chars = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[rand.Intn(len(chars))]
+	}
+	return string(b)
+}
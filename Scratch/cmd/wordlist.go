@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Deduplication uses a fixed 16 MiB Bloom filter on the first complete pass over
+// a list: about 0.3% of words are wrongly dropped as duplicates at 10M unique
+// words, 2% at 20M
+const (
+	bloomBits   = 1 << 27
+	bloomHashes = 7
+)
+
+// wordlistClient downloads URL wordlists. Downloads can be long, so there is no
+// overall deadline; instead a server that stops sending for wordlistIdle fails
+// the read rather than hanging the scan.
+var wordlistClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           idleTimeoutDialer(wordlistIdle),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       wordlistIdle,
+	},
+}
+
+const wordlistIdle = 60 * time.Second
+
+// idleTimeoutConn fails a read that waits longer than timeout for data
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// idleTimeoutDialer dials connections whose reads time out after timeout of silence
+func idleTimeoutDialer(timeout time.Duration) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &idleTimeoutConn{Conn: conn, timeout: timeout}, nil
+	}
+}
+
+// listFlag collects a flag that may be repeated or given as a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*l = append(*l, part)
+		}
+	}
+	return nil
+}
+
+// bloomFilter remembers words seen in a pass in constant memory
+type bloomFilter struct {
+	bits []uint64
+}
+
+func newBloomFilter() *bloomFilter {
+	return &bloomFilter{bits: make([]uint64, bloomBits/64)}
+}
+
+// add records s and reports whether it was (probably) not seen before. The
+// hashes are fixed, so every pass over the same input keeps the same words.
+func (b *bloomFilter) add(s string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	added := false
+	for i := uint32(0); i < bloomHashes; i++ {
+		bit := (h1 + i*h2) % bloomBits
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			b.bits[bit/64] |= 1 << (bit % 64)
+			added = true
+		}
+	}
+	return added
+}
+
+// wordlist streams words from every -w source: files, directories of files,
+// URLs and "-" for stdin, each optionally gzip or zstd compressed. Stdin and
+// URLs are spooled to a temp file on the first pass so later passes can replay
+// them, and the first complete pass spools the deduplicated words, which every
+// later pass replays instead of deduplicating again.
+type wordlist struct {
+	sources []string
+	domain  string
+	spools  map[string]string // source -> raw copy of stdin or a URL
+	uniques map[string]string // domain -> deduplicated words
+	temps   *tempFiles
+
+	// Counts from the last complete pass
+	Words, Duplicates, Invalid int
+}
+
+// newWordlist checks that every local source exists before the scan starts
+func newWordlist(sources []string, domain string) (*wordlist, error) {
+	for _, src := range sources {
+		if src == "-" || isURL(src) {
+			continue
+		}
+		if _, err := os.Stat(src); err != nil {
+			return nil, fmt.Errorf("failed to open wordlist file: %v", err)
+		}
+	}
+	return &wordlist{sources: sources, domain: domain, spools: make(map[string]string), uniques: make(map[string]string), temps: &tempFiles{}}, nil
+}
+
+// forDomain returns the same list normalized for another target domain. Spools
+// are shared, so stdin and URLs are still only read once per run.
+func (wl *wordlist) forDomain(domain string) *wordlist {
+	return &wordlist{sources: wl.sources, domain: domain, spools: wl.spools, uniques: wl.uniques, temps: wl.temps}
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// normalizeWord turns a raw line into a label sequence to prefix the domain
+// with. Full names under the domain and "*." prefixes are reduced to their
+// labels. Comments and blank lines give an empty word; ok is false for
+// anything that can't be part of a name.
+func (wl *wordlist) normalizeWord(line string) (word string, ok bool) {
+	word = strings.ToLower(strings.TrimSpace(line))
+	if word == "" || strings.HasPrefix(word, "#") {
+		return "", true
+	}
+	word = strings.TrimPrefix(strings.Trim(word, "."), "*.")
+	word = strings.TrimSuffix(word, "."+wl.domain)
+	if word == "" || word == wl.domain || len(word)+1+len(wl.domain) > 253 {
+		return "", false
+	}
+	for _, label := range strings.Split(word, ".") {
+		if !validLabel(label) {
+			return "", false
+		}
+	}
+	return word, true
+}
+
+// each calls fn with every unique, valid word in source order until fn returns false
+func (wl *wordlist) each(fn func(word string) bool) error {
+	if path, ok := wl.uniques[wl.domain]; ok {
+		return replayWords(path, fn)
+	}
+
+	// An early stop leaves the spool incomplete, so it is only kept after a full pass
+	spool, err := wl.temps.create("subscratcher-unique-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		spool.Close()
+		if _, ok := wl.uniques[wl.domain]; !ok {
+			os.Remove(spool.Name())
+		}
+	}()
+	out := bufio.NewWriter(spool)
+
+	seen := newBloomFilter()
+	words, dupes, invalid := 0, 0, 0
+	for _, src := range wl.sources {
+		paths := []string{src}
+		if info, err := os.Stat(src); err == nil && info.IsDir() {
+			if paths, err = listDir(src); err != nil {
+				return err
+			}
+		}
+		for _, path := range paths {
+			stop := false
+			err := wl.read(path, func(line string) bool {
+				word, ok := wl.normalizeWord(line)
+				switch {
+				case !ok:
+					invalid++
+				case word == "":
+				case !seen.add(word):
+					dupes++
+				default:
+					words++
+					out.WriteString(word + "\n")
+					if !fn(word) {
+						stop = true
+					}
+				}
+				return !stop
+			})
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+	}
+	wl.Words, wl.Duplicates, wl.Invalid = words, dupes, invalid
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	wl.uniques[wl.domain] = spool.Name()
+	return nil
+}
+
+// replayWords calls fn with every word of a deduplicated spool until fn returns false
+func replayWords(path string, fn func(word string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// head returns up to n words from the start of the list
+func (wl *wordlist) head(n int) []string {
+	var words []string
+	if n <= 0 {
+		return nil
+	}
+	wl.each(func(word string) bool {
+		words = append(words, word)
+		return len(words) < n
+	})
+	return words
+}
+
+// listDir returns the regular files below dir in lexical order
+func listDir(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// read opens one source and calls fn per line until fn returns false
+func (wl *wordlist) read(path string, fn func(line string) bool) error {
+	r, err := wl.open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	text, err := decompress(r)
+	if err != nil {
+		return fmt.Errorf("error reading wordlist %s: %v", path, err)
+	}
+	defer text.Close()
+	scanner := bufio.NewScanner(text)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading wordlist %s: %v", path, err)
+	}
+	return nil
+}
+
+// open returns the raw bytes of a source. Stdin and URLs are read once and
+// spooled; the spool replays them on later passes.
+func (wl *wordlist) open(path string) (io.ReadCloser, error) {
+	if spool, ok := wl.spools[path]; ok {
+		return os.Open(spool)
+	}
+
+	var body io.ReadCloser
+	switch {
+	case path == "-":
+		body = io.NopCloser(os.Stdin)
+	case isURL(path):
+		// Status goes to stderr so -url, -ip and -jsonl output stays pipeable
+		fmt.Fprintf(os.Stderr, "[*] Fetching wordlist from: %s\n", path)
+		resp, err := wordlistClient.Get(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download wordlist: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			resp.Body.Close()
+			return nil, fmt.Errorf("wordlist download failed with status: %d", resp.StatusCode)
+		}
+		body = resp.Body
+	default:
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open wordlist file: %v", err)
+		}
+		return f, nil
+	}
+
+	spool, err := wl.temps.create("subscratcher-words-*")
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	return &spoolReader{Reader: io.TeeReader(body, spool), body: body, spool: spool, done: func() { wl.spools[path] = spool.Name() }}, nil
+}
+
+// spoolReader copies a one-shot source to disk as it is read. Closing it
+// copies whatever the pass didn't read, so the spool is always complete.
+type spoolReader struct {
+	io.Reader
+	body  io.ReadCloser
+	spool *os.File
+	done  func()
+}
+
+func (s *spoolReader) Close() error {
+	_, err := io.Copy(s.spool, s.body)
+	s.body.Close()
+	if cerr := s.spool.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		s.done()
+	}
+	return err
+}
+
+// decompress detects gzip and zstd streams by their magic bytes
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		d, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
+
+// tempFiles remembers every spool created, finished or not, so close can
+// remove them even when a scan is interrupted partway through a pass
+type tempFiles struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (t *tempFiles) create(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err == nil {
+		t.mu.Lock()
+		t.paths = append(t.paths, f.Name())
+		t.mu.Unlock()
+	}
+	return f, err
+}
+
+// close removes the spool files
+func (wl *wordlist) close() {
+	if wl == nil {
+		return
+	}
+	wl.temps.mu.Lock()
+	defer wl.temps.mu.Unlock()
+	for _, path := range wl.temps.paths {
+		os.Remove(path)
+	}
+}
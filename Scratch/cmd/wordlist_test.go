@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zstded(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(s))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func allWords(t *testing.T, wl *wordlist) []string {
+	t.Helper()
+	var words []string
+	if err := wl.each(func(word string) bool {
+		words = append(words, word)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return words
+}
+
+func TestDecompressDetectsFormat(t *testing.T) {
+	const text = "www\napi\n"
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"plain", []byte(text)},
+		{"gzip", gzipped(t, text)},
+		{"zstd", zstded(t, text)},
+	}
+	for _, tt := range tests {
+		r, err := decompress(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != text {
+			t.Errorf("%s: read %q (%v), want %q", tt.name, got, err, text)
+		}
+	}
+}
+
+func TestWordlistDedupesAcrossSources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a.txt":     []byte("# comment\nwww\nAPI\n\nwww.example.com\n*.dev\nbad_label!\n"),
+		"b.txt.gz":  gzipped(t, "api\nmail\nwww\n"),
+		"c.txt.zst": zstded(t, "mail\nvpn.example.com.\nstaging.internal\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wl, err := newWordlist([]string{dir}, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wl.close()
+
+	want := []string{"www", "api", "dev", "mail", "vpn", "staging.internal"}
+	if got := allWords(t, wl); !slices.Equal(got, want) {
+		t.Errorf("words = %v, want %v", got, want)
+	}
+	if wl.Words != 6 || wl.Duplicates != 4 || wl.Invalid != 1 {
+		t.Errorf("counts = %d words, %d duplicates, %d invalid; want 6, 4, 1", wl.Words, wl.Duplicates, wl.Invalid)
+	}
+}
+
+func TestWordlistReplaysDeduplicatedSpool(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("www\napi\nwww\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wl, err := newWordlist([]string{path}, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wl.close()
+
+	// An early stop doesn't keep a partial spool
+	if got := wl.head(1); !slices.Equal(got, []string{"www"}) {
+		t.Fatalf("head(1) = %v", got)
+	}
+	if _, ok := wl.uniques["example.com"]; ok {
+		t.Fatal("spool kept after an incomplete pass")
+	}
+
+	first := allWords(t, wl)
+	// Later passes replay the spool, not the source
+	if err := os.WriteFile(path, []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if second := allWords(t, wl); !slices.Equal(first, second) || !slices.Equal(second, []string{"www", "api"}) {
+		t.Errorf("replayed %v after first pass %v", second, first)
+	}
+
+	// Another domain normalizes the source again
+	other := wl.forDomain("other.test")
+	if got := allWords(t, other); !slices.Equal(got, []string{"changed"}) {
+		t.Errorf("forDomain pass = %v, want [changed]", got)
+	}
+}
+
+func TestWordlistDownloadsURLOnce(t *testing.T) {
+	var hits int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&hits, 1)
+		w.Write(gzipped(t, "www\napi\nmail\n"))
+	}))
+	defer server.Close()
+
+	wl, err := newWordlist([]string{server.URL + "/words.gz"}, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := wl.forDomain("other.test")
+
+	// A pass stopped early still spools the whole download for the next one
+	wl.head(1)
+	if got := allWords(t, wl); !slices.Equal(got, []string{"www", "api", "mail"}) {
+		t.Errorf("words = %v", got)
+	}
+	if got := allWords(t, other); len(got) != 3 {
+		t.Errorf("other domain words = %v", got)
+	}
+	if n := atomic.LoadInt64(&hits); n != 1 {
+		t.Errorf("wordlist downloaded %d times, want 1", n)
+	}
+
+	spools := slices.Clone(wl.temps.paths)
+	wl.close()
+	for _, path := range spools {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("spool %s left behind: %v", path, err)
+		}
+	}
+}
+
+func TestNormalizeWord(t *testing.T) {
+	wl := &wordlist{domain: "example.com"}
+	tests := []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"  WWW ", "www", true},
+		{"# comment", "", true},
+		{"", "", true},
+		{"*.api", "api", true},
+		{"dev.example.com.", "dev", true},
+		{"example.com", "", false},
+		{"bad label", "", false},
+		{fmt.Sprintf("%0250d", 0), "", false},
+	}
+	for _, tt := range tests {
+		word, ok := wl.normalizeWord(tt.line)
+		if word != tt.want || ok != tt.ok {
+			t.Errorf("normalizeWord(%q) = %q, %v; want %q, %v", tt.line, word, ok, tt.want, tt.ok)
+		}
+	}
+}
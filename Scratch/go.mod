@@ -2,7 +2,11 @@ module github.com/lvcoi/SubScratcher
 
 go 1.25.5
 
-require github.com/projectdiscovery/cdncheck v1.2.18
+require (
+	github.com/klauspost/compress v1.18.2
+	github.com/miekg/dns v1.1.62
+	github.com/projectdiscovery/cdncheck v1.2.18
+)
 
 require (
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2 // indirect
@@ -11,7 +15,6 @@ require (
 	github.com/gorilla/css v1.0.1 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/microcosm-cc/bluemonday v1.0.27 // indirect
-	github.com/miekg/dns v1.1.62 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/projectdiscovery/blackrock v0.0.1 // indirect
 	github.com/projectdiscovery/retryabledns v1.0.112 // indirect
@@ -30,4 +33,7 @@ require (
 	golang.org/x/text v0.32.0 // indirect
 	golang.org/x/tools v0.39.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
+	scope v0.0.0
 )
+
+replace scope => ../Scope
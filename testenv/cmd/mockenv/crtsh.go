@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// crtshEntry mirrors the fields of crt.sh's JSON output
+type crtshEntry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	CommonName   string `json:"common_name"`
+	NameValue    string `json:"name_value"`
+	NotBefore    string `json:"not_before"`
+	NotAfter     string `json:"not_after"`
+	SerialNumber string `json:"serial_number"`
+}
+
+const mockIssuer = "C=US, O=Mock CA, CN=Mock Issuing CA"
+
+// crtshHandler answers crt.sh style "?q=%.domain&output=json" searches with
+// one fake certificate per zone name under the queried domain, plus wildcard
+// and noisy multi-SAN certificates
+func crtshHandler(z *dnsZone) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain := strings.ToLower(strings.TrimPrefix(r.URL.Query().Get("q"), "%."))
+		if domain == "" || r.URL.Query().Get("output") != "json" {
+			http.Error(w, "expected ?q=%.domain&output=json", http.StatusBadRequest)
+			return
+		}
+
+		var names []string
+		for name := range z.hosts {
+			if inOrigin(name, domain) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		entries := []crtshEntry{}
+		add := func(cn, names, issuer, notBefore, notAfter string) {
+			entries = append(entries, crtshEntry{
+				ID:           int64(1000 + len(entries)),
+				IssuerName:   issuer,
+				CommonName:   cn,
+				NameValue:    names,
+				NotBefore:    notBefore,
+				NotAfter:     notAfter,
+				SerialNumber: fmt.Sprintf("%08x", 0x0a1b2c3d+len(entries)),
+			})
+		}
+		for _, name := range names {
+			add(name, name, mockIssuer, "2024-01-01T00:00:00", "2099-01-01T00:00:00")
+		}
+
+		// Wildcard certificates for every intermediate zone (*.staging.local.test)
+		parents := make(map[string]bool)
+		for _, name := range names {
+			if _, parent, ok := strings.Cut(name, "."); ok && parent != domain && inOrigin(parent, domain) && !strings.HasPrefix(name, "*.") {
+				parents[parent] = true
+			}
+		}
+		for _, parent := range sortedKeys(parents) {
+			add("*."+parent, "*."+parent+"\n"+parent, mockIssuer, "2024-01-01T00:00:00", "2099-01-01T00:00:00")
+		}
+
+		// The kind of noise real crt.sh returns: one expired multi-SAN cert with
+		// mixed case, a contact address and a name outside the search domain
+		if len(names) > 0 {
+			add(strings.ToUpper(names[0]), strings.ToUpper(names[0])+"\nhostmaster@"+domain+"\nwww.unrelated.example\nlegacy-vpn."+domain+".",
+				"C=US, O=Old CA Inc, CN=Old CA Issuing 2019", "2019-03-01T12:00:00.123", "2020-03-01T12:00:00")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultZoneHosts is served when no -dns-hosts file is given
+var defaultZoneHosts = map[string][]string{
+	"local.test":     {"127.0.0.1"},
+	"www.local.test": {"127.0.0.1"},
+}
+
+// dnsZone answers from a hosts map; names it doesn't know are NXDOMAIN.
+// It is authoritative for origin and serves its SOA, NS and zone transfers.
+type dnsZone struct {
+	hosts         map[string][]string
+	extra         map[string][]dns.RR // extra records (TXT, MX, ...) by owner name
+	origin        string
+	allowTransfer bool
+	denial        string // "", "nsec" or "nsec3": DNSSEC-style denial records to serve
+}
+
+// newDNSZone builds a zone for origin with ns1.<origin> pointing at nsIP
+func newDNSZone(hosts map[string][]string, origin, nsIP string, allowTransfer bool) *dnsZone {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+	z := &dnsZone{hosts: make(map[string][]string), extra: make(map[string][]dns.RR), origin: origin, allowTransfer: allowTransfer}
+	for host, values := range hosts {
+		z.hosts[host] = values
+	}
+	if _, ok := z.hosts["ns1."+origin]; !ok {
+		z.hosts["ns1."+origin] = []string{nsIP}
+	}
+	return z
+}
+
+// loadZoneHosts reads the same "host ip1 [ip2...]" format Scratch uses for -hosts.
+// Values that aren't IPs are served as a CNAME, and "*.zone" entries as wildcards.
+func loadZoneHosts(path string) (map[string][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hosts := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid hosts entry at line %d", lineNum)
+		}
+		host := strings.ToLower(strings.TrimSuffix(fields[0], "."))
+		hosts[host] = append(hosts[host], fields[1:]...)
+	}
+	return hosts, scanner.Err()
+}
+
+// loadZoneRecords reads standard zone-file RR lines ("_dmarc.local.test. 60 IN TXT \"v=DMARC1...\"")
+// and adds them to the zone alongside the hosts map
+func (z *dnsZone) loadZoneRecords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	parser := dns.NewZoneParser(file, dns.Fqdn(z.origin), path)
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		name := strings.ToLower(strings.TrimSuffix(rr.Header().Name, "."))
+		z.extra[name] = append(z.extra[name], rr)
+	}
+	return parser.Err()
+}
+
+func (z *dnsZone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	if len(r.Question) > 0 && (r.Question[0].Qtype == dns.TypeAXFR || r.Question[0].Qtype == dns.TypeIXFR) {
+		z.transfer(w, r)
+		return
+	}
+	w.WriteMsg(z.answer(r))
+}
+
+// soa is the zone's start of authority, which also frames transfers
+func (z *dnsZone) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     rrHeader(dns.Fqdn(z.origin), dns.TypeSOA),
+		Ns:      dns.Fqdn("ns1." + z.origin),
+		Mbox:    dns.Fqdn("hostmaster." + z.origin),
+		Serial:  2024010101,
+		Refresh: 3600, Retry: 600, Expire: 86400, Minttl: 60,
+	}
+}
+
+// records lists every in-zone record, as served by a transfer
+func (z *dnsZone) records() []dns.RR {
+	rrs := []dns.RR{&dns.NS{Hdr: rrHeader(dns.Fqdn(z.origin), dns.TypeNS), Ns: dns.Fqdn("ns1." + z.origin)}}
+	var names []string
+	for name := range z.hosts {
+		if name == z.origin || strings.HasSuffix(name, "."+z.origin) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		owner := dns.Fqdn(name)
+		for _, v := range z.hosts[name] {
+			ip := net.ParseIP(v)
+			switch {
+			case ip == nil:
+				rrs = append(rrs, &dns.CNAME{Hdr: rrHeader(owner, dns.TypeCNAME), Target: dns.Fqdn(v)})
+			case ip.To4() != nil:
+				rrs = append(rrs, &dns.A{Hdr: rrHeader(owner, dns.TypeA), A: ip})
+			default:
+				rrs = append(rrs, &dns.AAAA{Hdr: rrHeader(owner, dns.TypeAAAA), AAAA: ip})
+			}
+		}
+	}
+
+	var extraNames []string
+	for name := range z.extra {
+		if inOrigin(name, z.origin) {
+			extraNames = append(extraNames, name)
+		}
+	}
+	sort.Strings(extraNames)
+	for _, name := range extraNames {
+		rrs = append(rrs, z.extra[name]...)
+	}
+	return rrs
+}
+
+// transfer answers AXFR/IXFR with the full zone framed by SOA records
+func (z *dnsZone) transfer(w dns.ResponseWriter, r *dns.Msg) {
+	name := strings.ToLower(strings.TrimSuffix(r.Question[0].Name, "."))
+	if !z.allowTransfer || name != z.origin {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	log.Printf("DNS zone transfer of %s to %s", z.origin, w.RemoteAddr())
+	rrs := append([]dns.RR{z.soa()}, z.records()...)
+	rrs = append(rrs, z.soa())
+
+	ch := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+	done := make(chan struct{})
+	go func() {
+		tr.Out(w, r, ch)
+		close(done)
+	}()
+	ch <- &dns.Envelope{RR: rrs}
+	close(ch)
+	<-done
+	w.Close()
+}
+
+// answer builds the reply for r
+func (z *dnsZone) answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	if len(r.Question) == 0 {
+		m.Rcode = dns.RcodeFormatError
+		return m
+	}
+
+	q := r.Question[0]
+	do := r.IsEdns0() != nil && r.IsEdns0().Do()
+	if r.IsEdns0() != nil {
+		m.SetEdns0(4096, do)
+	}
+
+	if strings.EqualFold(strings.TrimSuffix(q.Name, "."), z.origin) {
+		switch q.Qtype {
+		case dns.TypeSOA:
+			m.Answer = append(m.Answer, z.soa())
+			return m
+		case dns.TypeNS:
+			m.Answer = append(m.Answer, z.records()[0])
+			return m
+		case dns.TypeDNSKEY:
+			if z.denial != "" {
+				m.Answer = append(m.Answer, z.dnskey())
+			}
+			return m
+		}
+	}
+	if q.Qtype == dns.TypeNSEC && z.denial == "nsec" {
+		if name := strings.ToLower(strings.TrimSuffix(q.Name, ".")); z.exists(name) {
+			m.Answer = append(m.Answer, z.nsecAt(name))
+			return m
+		}
+	}
+
+	if q.Qtype == dns.TypePTR {
+		if names := z.reverse(q.Name); len(names) > 0 {
+			for _, name := range names {
+				m.Answer = append(m.Answer, &dns.PTR{Hdr: rrHeader(q.Name, dns.TypePTR), Ptr: dns.Fqdn(name)})
+			}
+			return m
+		}
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	if rrs, ok := z.extra[name]; ok {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, dns.Copy(rr))
+			}
+		}
+		// An alias answers every type, as an unresolved CNAME
+		if len(m.Answer) == 0 {
+			for _, rr := range rrs {
+				if rr.Header().Rrtype == dns.TypeCNAME {
+					m.Answer = append(m.Answer, dns.Copy(rr))
+				}
+			}
+		}
+		// A name with only extra records exists; answer NODATA for other types
+		if _, isHost := z.hosts[name]; len(m.Answer) > 0 || !isHost {
+			return m
+		}
+	}
+
+	values, ok := z.lookup(q.Name)
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+		if do {
+			m.Ns = append(m.Ns, z.soa())
+			m.Ns = append(m.Ns, z.denialProof(strings.ToLower(strings.TrimSuffix(q.Name, ".")))...)
+		}
+		return m
+	}
+
+	// Non-IP values are CNAME targets; follow them inside the zone like a recursor would
+	owner := q.Name
+	for hops := 0; hops < 8; hops++ {
+		target := ""
+		for _, v := range values {
+			ip := net.ParseIP(v)
+			switch {
+			case ip == nil:
+				target = dns.Fqdn(strings.ToLower(v))
+			case ip.To4() != nil && q.Qtype == dns.TypeA:
+				m.Answer = append(m.Answer, &dns.A{Hdr: rrHeader(owner, dns.TypeA), A: ip})
+			case ip.To4() == nil && q.Qtype == dns.TypeAAAA:
+				m.Answer = append(m.Answer, &dns.AAAA{Hdr: rrHeader(owner, dns.TypeAAAA), AAAA: ip})
+			}
+		}
+		if target == "" {
+			break
+		}
+		m.Answer = append(m.Answer, &dns.CNAME{Hdr: rrHeader(owner, dns.TypeCNAME), Target: target})
+		if q.Qtype == dns.TypeCNAME {
+			break
+		}
+		if values, ok = z.lookup(target); !ok {
+			// A dangling alias: recursors answer NXDOMAIN along with the CNAME
+			m.Rcode = dns.RcodeNameError
+			break
+		}
+		owner = target
+	}
+	return m
+}
+
+// reverse returns the hosts whose addresses match an in-addr.arpa/ip6.arpa name
+func (z *dnsZone) reverse(arpa string) []string {
+	arpa = strings.ToLower(dns.Fqdn(arpa))
+	var names []string
+	for host, values := range z.hosts {
+		if strings.HasPrefix(host, "*.") {
+			continue
+		}
+		for _, v := range values {
+			if rev, err := dns.ReverseAddr(v); err == nil && rev == arpa {
+				names = append(names, host)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookup finds name in the zone, falling back to the closest "*." wildcard entry
+func (z *dnsZone) lookup(name string) ([]string, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if values, ok := z.hosts[name]; ok {
+		return values, true
+	}
+	for parent := name; strings.Contains(parent, "."); {
+		parent = parent[strings.Index(parent, ".")+1:]
+		if values, ok := z.hosts["*."+parent]; ok {
+			return values, true
+		}
+	}
+	return nil, false
+}
+
+// dohHandler serves the zone over RFC 8484 (POST body or GET ?dns= base64url)
+func dohHandler(z *dnsZone) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var packed []byte
+		var err error
+		switch r.Method {
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != "application/dns-message" {
+				http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+				return
+			}
+			packed, err = io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize))
+		case http.MethodGet:
+			packed, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := new(dns.Msg)
+		if err := req.Unpack(packed); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		out, err := z.answer(req).Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}
+}
+
+// liarHandler answers every A query with the same address, like an NXDOMAIN-hijacking ISP resolver
+func liarHandler(addr string) dns.HandlerFunc {
+	ip := net.ParseIP(addr)
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if len(r.Question) > 0 && r.Question[0].Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, &dns.A{Hdr: rrHeader(r.Question[0].Name, dns.TypeA), A: ip})
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func rrHeader(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 60}
+}
+
+// startDNS serves handler on addr over each of the given networks ("udp", "tcp", "tcp-tls")
+func startDNS(label, addr string, handler dns.Handler, tlsConfig *tls.Config, networks ...string) []*dns.Server {
+	var servers []*dns.Server
+	for _, network := range networks {
+		srv := &dns.Server{Addr: addr, Net: network, Handler: handler, TLSConfig: tlsConfig}
+		servers = append(servers, srv)
+		go func() {
+			log.Printf("%s listening on %s/%s", label, addr, srv.Net)
+			if err := srv.ListenAndServe(); err != nil {
+				log.Printf("%s %s error: %v", label, srv.Net, err)
+			}
+		}()
+	}
+	return servers
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// NSEC3 parameters served by the stand-in (SHA-1, a few iterations and a salt,
+// so clients have to honor all three)
+const (
+	nsec3Iterations = 2
+	nsec3Salt       = "AABBCCDD"
+)
+
+// dnskey is a placeholder key; the stand-in doesn't sign anything, it only
+// advertises a key so clients treat the zone as signed
+func (z *dnsZone) dnskey() dns.RR {
+	return &dns.DNSKEY{
+		Hdr:       rrHeader(dns.Fqdn(z.origin), dns.TypeDNSKEY),
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+		PublicKey: "mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==",
+	}
+}
+
+// exists reports whether name owns records in the zone (wildcard expansion doesn't count)
+func (z *dnsZone) exists(name string) bool {
+	if name == z.origin {
+		return true
+	}
+	_, host := z.hosts[name]
+	_, extra := z.extra[name]
+	return (host || extra) && inOrigin(name, z.origin)
+}
+
+// owners lists the zone's names in canonical DNS order
+func (z *dnsZone) owners() []string {
+	seen := map[string]bool{z.origin: true}
+	names := []string{z.origin}
+	for _, set := range []map[string]bool{keysOf(z.hosts), keysOf(z.extra)} {
+		for name := range set {
+			if !seen[name] && inOrigin(name, z.origin) {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+	return names
+}
+
+// typesAt returns the record types present at name, for NSEC/NSEC3 bitmaps
+func (z *dnsZone) typesAt(name string) []uint16 {
+	set := map[uint16]bool{dns.TypeRRSIG: true}
+	if name == z.origin {
+		set[dns.TypeSOA], set[dns.TypeNS], set[dns.TypeDNSKEY] = true, true, true
+		if z.denial == "nsec3" {
+			set[dns.TypeNSEC3PARAM] = true
+		}
+	}
+	if z.denial == "nsec" {
+		set[dns.TypeNSEC] = true
+	}
+	for _, v := range z.hosts[name] {
+		ip := net.ParseIP(v)
+		switch {
+		case ip == nil:
+			set[dns.TypeCNAME] = true
+		case ip.To4() != nil:
+			set[dns.TypeA] = true
+		default:
+			set[dns.TypeAAAA] = true
+		}
+	}
+	for _, rr := range z.extra[name] {
+		set[rr.Header().Rrtype] = true
+	}
+	var types []uint16
+	for t := range set {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// nsecAt builds the NSEC record owned by name
+func (z *dnsZone) nsecAt(name string) dns.RR {
+	owners := z.owners()
+	i := sort.Search(len(owners), func(i int) bool { return !canonicalLess(owners[i], name) })
+	next := owners[(i+1)%len(owners)]
+	return &dns.NSEC{
+		Hdr:        rrHeader(dns.Fqdn(name), dns.TypeNSEC),
+		NextDomain: dns.Fqdn(next),
+		TypeBitMap: z.typesAt(name),
+	}
+}
+
+// denialProof returns the record covering a name that doesn't exist: the NSEC
+// of its canonical predecessor, or the NSEC3 whose hash range contains it
+func (z *dnsZone) denialProof(qname string) []dns.RR {
+	switch z.denial {
+	case "nsec":
+		owners := z.owners()
+		i := sort.Search(len(owners), func(i int) bool { return canonicalLess(qname, owners[i]) })
+		return []dns.RR{z.nsecAt(owners[(i-1+len(owners))%len(owners)])}
+	case "nsec3":
+		type hashed struct{ hash, name string }
+		var chain []hashed
+		for _, name := range z.owners() {
+			chain = append(chain, hashed{dns.HashName(dns.Fqdn(name), dns.SHA1, nsec3Iterations, nsec3Salt), name})
+		}
+		sort.Slice(chain, func(i, j int) bool { return chain[i].hash < chain[j].hash })
+
+		h := dns.HashName(dns.Fqdn(qname), dns.SHA1, nsec3Iterations, nsec3Salt)
+		i := sort.Search(len(chain), func(i int) bool { return chain[i].hash > h })
+		prev := chain[(i-1+len(chain))%len(chain)]
+		next := chain[i%len(chain)]
+		return []dns.RR{&dns.NSEC3{
+			Hdr:        rrHeader(dns.Fqdn(strings.ToLower(prev.hash)+"."+z.origin), dns.TypeNSEC3),
+			Hash:       dns.SHA1,
+			Iterations: nsec3Iterations,
+			SaltLength: uint8(len(nsec3Salt) / 2),
+			Salt:       nsec3Salt,
+			HashLength: 20,
+			NextDomain: next.hash,
+			TypeBitMap: z.typesAt(prev.name),
+		}}
+	}
+	return nil
+}
+
+// canonicalLess orders names per RFC 4034 6.1: label by label from the root,
+// comparing the raw (unescaped, lowercased) label bytes
+func canonicalLess(a, b string) bool {
+	la, lb := wireLabels(a), wireLabels(b)
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := bytes.Compare(la[len(la)-i], lb[len(lb)-i]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(la) < len(lb)
+}
+
+// wireLabels splits name into its wire-format labels so escapes like \000 compare correctly
+func wireLabels(name string) [][]byte {
+	buf := make([]byte, 256)
+	off, err := dns.PackDomainName(dns.Fqdn(strings.ToLower(name)), buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+	var labels [][]byte
+	for i := 0; i < off && buf[i] != 0; i += int(buf[i]) + 1 {
+		labels = append(labels, buf[i+1:i+1+int(buf[i])])
+	}
+	return labels
+}
+
+// inOrigin reports whether name is origin or below it
+func inOrigin(name, origin string) bool {
+	return name == origin || strings.HasSuffix(name, "."+origin)
+}
+
+// keysOf returns the owner names of a hosts or records map as a set
+func keysOf[V any](m map[string]V) map[string]bool {
+	set := make(map[string]bool, len(m))
+	for k := range m {
+		set[k] = true
+	}
+	return set
+}
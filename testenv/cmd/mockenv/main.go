@@ -18,6 +18,8 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"github.com/miekg/dns"
 )
 
 func main() {
@@ -26,12 +28,48 @@ func main() {
 	httpsPort := flag.Int("https", 8443, "HTTPS port")
 	rawPort := flag.Int("raw", 5666, "Raw TCP port")
 	allow := flag.String("allow", "allowed.test", "Comma-separated Host headers that return 200")
+	dnsPort := flag.Int("dns", 5300, "DNS port (UDP+TCP, 0 = disabled)")
+	dnsRecords := flag.String("dns-records", "", "Zone-file style records (TXT, MX, ...) served alongside -dns-hosts")
+	dnsHosts := flag.String("dns-hosts", "", "Hosts file served by the DNS stand-in (format: host ip1 [ip2...])")
+	liarPort := flag.Int("dns-liar", 0, "Port for a resolver that answers every name (0 = disabled)")
+	zoneName := flag.String("zone", "local.test", "Zone the DNS stand-in is authoritative for")
+	allowAXFR := flag.Bool("axfr", true, "Allow AXFR/IXFR of the zone")
+	denial := flag.String("dnssec", "", "Serve the zone as DNSSEC-signed with \"nsec\" or \"nsec3\" denial records")
+	dotPort := flag.Int("dot", 0, "DNS-over-TLS port (0 = disabled); DoH is always on HTTPS /dns-query")
+	smtpPort := flag.Int("smtp", 0, "SMTP stand-in port (0 = disabled)")
+	smtpHost := flag.String("smtp-host", "", "Hostname announced in the SMTP banner and EHLO reply (default: mx01.<zone>)")
 	flag.Parse()
 
 	log.SetFlags(0)
 
 	allowedHosts := parseAllowedHosts(*allow)
-	handler := hostHandler(allowedHosts)
+
+	zoneHosts := defaultZoneHosts
+	if *dnsHosts != "" {
+		hosts, err := loadZoneHosts(*dnsHosts)
+		if err != nil {
+			log.Fatalf("DNS hosts file error: %v", err)
+		}
+		zoneHosts = hosts
+	}
+	zone := newDNSZone(zoneHosts, *zoneName, *bind, *allowAXFR)
+	if *dnsRecords != "" {
+		if err := zone.loadZoneRecords(*dnsRecords); err != nil {
+			log.Fatalf("DNS records file error: %v", err)
+		}
+	}
+	switch *denial {
+	case "", "nsec", "nsec3":
+		zone.denial = *denial
+	default:
+		log.Fatalf("-dnssec must be nsec or nsec3, got %q", *denial)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/dns-query", dohHandler(zone))
+	mux.Handle("/crtsh/", crtshHandler(zone))
+	mux.Handle("/", hostHandler(allowedHosts))
+	handler := mux
 
 	httpAddr := fmt.Sprintf("%s:%d", *bind, *httpPort)
 	httpsAddr := fmt.Sprintf("%s:%d", *bind, *httpsPort)
@@ -60,6 +98,32 @@ func main() {
 		log.Fatalf("RAW listen failed: %v", err)
 	}
 
+	var smtpLn net.Listener
+	if *smtpPort > 0 {
+		smtpAddr := fmt.Sprintf("%s:%d", *bind, *smtpPort)
+		smtpLn, err = net.Listen("tcp", smtpAddr)
+		if err != nil {
+			log.Fatalf("SMTP listen failed: %v", err)
+		}
+		host := *smtpHost
+		if host == "" {
+			host = "mx01." + *zoneName
+		}
+		log.Printf("SMTP listening on %s", smtpAddr)
+		go serveSMTP(ctx, smtpLn, host)
+	}
+
+	var dnsServers []*dns.Server
+	if *dnsPort > 0 {
+		dnsServers = append(dnsServers, startDNS("DNS", fmt.Sprintf("%s:%d", *bind, *dnsPort), zone, nil, "udp", "tcp")...)
+	}
+	if *dotPort > 0 {
+		dnsServers = append(dnsServers, startDNS("DoT", fmt.Sprintf("%s:%d", *bind, *dotPort), zone, tlsConfig, "tcp-tls")...)
+	}
+	if *liarPort > 0 {
+		dnsServers = append(dnsServers, startDNS("DNS-LIAR", fmt.Sprintf("%s:%d", *bind, *liarPort), liarHandler("203.0.113.66"), nil, "udp", "tcp")...)
+	}
+
 	go func() {
 		log.Printf("HTTP listening on %s", httpAddr)
 		if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -85,6 +149,12 @@ func main() {
 	_ = httpSrv.Shutdown(shutdownCtx)
 	_ = httpsSrv.Shutdown(shutdownCtx)
 	_ = rawLn.Close()
+	if smtpLn != nil {
+		_ = smtpLn.Close()
+	}
+	for _, srv := range dnsServers {
+		_ = srv.ShutdownContext(shutdownCtx)
+	}
 }
 
 func parseAllowedHosts(input string) map[string]bool {
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// serveSMTP accepts connections and plays a minimal ESMTP server announcing host
+func serveSMTP(ctx context.Context, ln net.Listener, host string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+				log.Printf("SMTP accept error: %v", err)
+				continue
+			}
+		}
+		go handleSMTP(conn, host)
+	}
+}
+
+// handleSMTP sends the banner and answers EHLO/HELO/QUIT; everything else is refused
+func handleSMTP(conn net.Conn, host string) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	fmt.Fprintf(conn, "220 %s ESMTP Postfix (mockenv)\r\n", host)
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			fmt.Fprintf(conn, "250-%s Hello %s\r\n250-PIPELINING\r\n250-SIZE 10240000\r\n250-STARTTLS\r\n250 8BITMIME\r\n", host, arg)
+		case "HELO":
+			fmt.Fprintf(conn, "250 %s\r\n", host)
+		case "QUIT":
+			fmt.Fprintf(conn, "221 2.0.0 Bye\r\n")
+			return
+		default:
+			fmt.Fprintf(conn, "502 5.5.2 Error: command not recognized\r\n")
+		}
+	}
+}